@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleAcceptsGoDuration(t *testing.T) {
+	sched, err := parseSchedule("1h")
+	if err != nil {
+		t.Fatalf("parseSchedule returned error: %v", err)
+	}
+
+	from := time.Date(2026, time.March, 5, 9, 0, 0, 0, time.UTC)
+
+	next, err := sched.next(from)
+	if err != nil {
+		t.Fatalf("next returned error: %v", err)
+	}
+
+	if !next.Equal(from.Add(time.Hour)) {
+		t.Errorf("expected %v, got %v", from.Add(time.Hour), next)
+	}
+}
+
+func TestParseScheduleAcceptsCronExpression(t *testing.T) {
+	sched, err := parseSchedule("30 9 * * *")
+	if err != nil {
+		t.Fatalf("parseSchedule returned error: %v", err)
+	}
+
+	from := time.Date(2026, time.March, 5, 9, 0, 0, 0, time.UTC)
+
+	next, err := sched.next(from)
+	if err != nil {
+		t.Fatalf("next returned error: %v", err)
+	}
+
+	if next.Hour() != 9 || next.Minute() != 30 {
+		t.Errorf("expected 09:30, got %v", next)
+	}
+}
+
+func TestParseScheduleRejectsGarbage(t *testing.T) {
+	if _, err := parseSchedule("not a schedule"); err == nil {
+		t.Error("expected an error for an unparseable --schedule value")
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"github.com/fhirbase/fhirbase/storage"
+)
+
+// BulkExportManifest is the completed Bulk Data kickoff response: the
+// server's transactionTime and the list of NDJSON files it produced.
+type BulkExportManifest struct {
+	TransactionTime time.Time              `json:"transactionTime"`
+	Output          []BulkExportOutputFile `json:"output"`
+}
+
+// BulkExportOutputFile is a single entry of a completed export manifest.
+type BulkExportOutputFile struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// BulkGetCommand downloads FHIR data from a Bulk Data API endpoint and
+// saves the resulting NDJSON files into TARGET DIR, which may be a local
+// path or an s3://, az:// or gs:// storage.Backend URI.
+//
+// Without "--since", each run resumes from the "transactionTime" of the
+// endpoint's last successful export, checkpointed in the
+// "fhirbase_bulk_state" table; use the "bulk-state" command to inspect or
+// reset it. "--schedule" keeps the process alive, re-kicking the export
+// on the given interval instead of exiting after the first pull.
+func BulkGetCommand(c *cli.Context) error {
+	if c.NArg() < 2 {
+		return cli.NewExitError("bulkget requires ENDPOINT and TARGET DIR arguments", 1)
+	}
+
+	endpoint := c.Args().Get(0)
+	target := c.Args().Get(1)
+	acceptHeader := c.String("accept-header")
+	numdl := c.Uint("numdl")
+	since := c.String("since")
+	scheduleExpr := c.String("schedule")
+
+	db, err := OpenDB(PgConfig)
+	if err != nil {
+		return errors.Wrap(err, "cannot connect to database")
+	}
+	defer db.Close()
+
+	if err := ensureBulkStateTable(db); err != nil {
+		return err
+	}
+
+	run := func() error {
+		return checkpointedBulkGet(db, endpoint, target, acceptHeader, numdl, since)
+	}
+
+	if scheduleExpr == "" {
+		return run()
+	}
+
+	return runOnSchedule(scheduleExpr, run)
+}
+
+// checkpointedBulkGet resolves the effective "_since" cursor (the
+// explicit "--since", or the checkpointed transactionTime from the
+// previous run if omitted), runs the export, and checkpoints the new
+// transactionTime on success.
+func checkpointedBulkGet(db *sql.DB, endpoint, target, acceptHeader string, numdl uint, since string) error {
+	effectiveSince := since
+
+	if effectiveSince == "" {
+		state, err := loadBulkState(db, endpoint)
+		if err != nil {
+			return errors.Wrap(err, "cannot load bulk state")
+		}
+
+		if !state.TransactionTime.IsZero() {
+			effectiveSince = state.TransactionTime.Format(time.RFC3339)
+		}
+	}
+
+	manifest, err := runBulkGet(endpoint, target, acceptHeader, numdl, effectiveSince)
+	if err != nil {
+		return err
+	}
+
+	return saveBulkState(db, endpoint, manifest.TransactionTime)
+}
+
+// runBulkGet kicks off a single Bulk Data export against endpoint,
+// forwarding since as "_since" when non-empty, and downloads every output
+// file into target.
+func runBulkGet(endpoint, target, acceptHeader string, numdl uint, since string) (*BulkExportManifest, error) {
+	manifest, err := kickoffBulkExport(endpoint, acceptHeader, since)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot kick off bulk export")
+	}
+
+	backend, err := storage.NewBackend(target)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot open target %q", target)
+	}
+
+	items := make([]interface{}, len(manifest.Output))
+	for i, o := range manifest.Output {
+		items[i] = o
+	}
+
+	if err := runWithWorkers(numdl, items, func(item interface{}) error {
+		return downloadBulkFile(backend, item.(BulkExportOutputFile))
+	}); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// kickoffBulkExport starts an async Bulk Data export against endpoint and
+// polls its Content-Location until the export manifest is ready. When
+// since is non-empty it is forwarded as the "_since" query parameter, per
+// the Bulk Data API's incremental export convention.
+func kickoffBulkExport(endpoint, acceptHeader, since string) (*BulkExportManifest, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if since != "" {
+		q := req.URL.Query()
+		q.Set("_since", since)
+		req.URL.RawQuery = q.Encode()
+	}
+
+	req.Header.Set("Accept", acceptHeader)
+	req.Header.Set("Prefer", "respond-async")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, errors.Errorf("bulk export kickoff returned %s", resp.Status)
+	}
+
+	statusURL := resp.Header.Get("Content-Location")
+	if statusURL == "" {
+		return nil, errors.New("kickoff response is missing a Content-Location header")
+	}
+
+	return pollBulkExportStatus(statusURL)
+}
+
+// pollBulkExportStatus polls statusURL until the server reports the
+// export is complete (200 OK with the manifest body), per the Bulk Data
+// API's asynchronous status pattern.
+func pollBulkExportStatus(statusURL string) (*BulkExportManifest, error) {
+	for {
+		resp, err := http.Get(statusURL)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusAccepted {
+			resp.Body.Close()
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, errors.Errorf("bulk export status returned %s", resp.Status)
+		}
+
+		var manifest BulkExportManifest
+		err = json.NewDecoder(resp.Body).Decode(&manifest)
+		resp.Body.Close()
+
+		return &manifest, err
+	}
+}
+
+// downloadBulkFile downloads a single output file and writes it into
+// backend, named after the source URL (or the resource type, if the URL
+// has no discernible file name).
+func downloadBulkFile(backend storage.Backend, o BulkExportOutputFile) error {
+	resp, err := http.Get(o.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("download of %s returned %s", o.URL, resp.Status)
+	}
+
+	filename := filepath.Base(o.URL)
+	if filename == "" || filename == "." || filename == "/" {
+		filename = o.Type + ".ndjson"
+	}
+
+	w, err := backend.Writer(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	_, err = io.Copy(w, resp.Body)
+
+	return err
+}
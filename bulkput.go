@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"github.com/fhirbase/fhirbase/storage"
+)
+
+// BulkPutTarget describes where bulkput should deliver resources: either a
+// remote FHIR endpoint (bundle mode) or an NDJSON directory/object-storage
+// prefix (ndjson mode).
+type BulkPutTarget struct {
+	URL           string
+	BasicAuth     string
+	BearerToken   string
+	Mode          string
+	BatchSize     uint
+	NumWorkers    uint
+	ResourceTypes []string
+	Since         string
+}
+
+// BulkPutCommand reads resources out of the Fhirbase database and pushes
+// them to a remote FHIR server or to NDJSON files, mirroring the shape of
+// BulkGetCommand but in the opposite direction.
+//
+// In "bundle" mode resources are batched into transaction Bundles with PUT
+// entries keyed on resource id and streamed to "--target" by a pool of
+// parallel workers, each retrying failed batches with exponential backoff.
+// In "ndjson" mode resources are grouped by type (per the Bulk Data
+// grouping rule, one file per resource type) and written as gzipped NDJSON
+// to a local directory or, via storage.Backend, to S3 or Azure Blob.
+func BulkPutCommand(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return cli.NewExitError("bulkput requires a TARGET argument", 1)
+	}
+
+	target := BulkPutTarget{
+		URL:           c.String("target"),
+		BasicAuth:     c.String("target-basic-auth"),
+		BearerToken:   c.String("target-bearer-token"),
+		Mode:          c.String("mode"),
+		BatchSize:     c.Uint("batch-size"),
+		NumWorkers:    c.Uint("numdl"),
+		ResourceTypes: splitCommaFlag(c.String("resource-types")),
+		Since:         c.String("since"),
+	}
+
+	if target.Mode != "bundle" && target.Mode != "ndjson" {
+		return cli.NewExitError(fmt.Sprintf("unknown bulkput mode %q, expected 'bundle' or 'ndjson'", target.Mode), 1)
+	}
+
+	if target.Mode == "bundle" && target.URL == "" {
+		return cli.NewExitError("bulkput requires --target in 'bundle' mode", 1)
+	}
+
+	dest := c.Args().First()
+
+	stream, err := newResourceStream(target.ResourceTypes, target.Since)
+	if err != nil {
+		return errors.Wrap(err, "cannot open resource stream")
+	}
+	defer stream.Close()
+
+	switch target.Mode {
+	case "bundle":
+		return pushBundles(stream, target)
+	default:
+		return pushNDJSON(stream, dest)
+	}
+}
+
+// pushBundles batches resources from stream into transaction Bundles and
+// PUTs them to target.URL using a pool of target.NumWorkers workers, each
+// batch retried with exponential backoff on failure. Batches are handed
+// to the workers over a bounded channel as stream is read, rather than
+// collected into memory up front, so a full push never needs to hold
+// more than a handful of batches at once.
+func pushBundles(stream *resourceStream, target BulkPutTarget) error {
+	numWorkers := target.NumWorkers
+	if numWorkers == 0 {
+		numWorkers = 1
+	}
+
+	batches := make(chan []RawResource, numWorkers)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	for i := uint(0); i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for batch := range batches {
+				if err := putTransactionBundle(target, batch); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	batch := make([]RawResource, 0, target.BatchSize)
+	for stream.Next() {
+		batch = append(batch, stream.Resource())
+
+		if uint(len(batch)) >= target.BatchSize {
+			batches <- batch
+			batch = make([]RawResource, 0, target.BatchSize)
+		}
+	}
+
+	if len(batch) > 0 {
+		batches <- batch
+	}
+
+	close(batches)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return stream.Err()
+}
+
+// putTransactionBundle POSTs batch as a single transaction Bundle with PUT
+// entries keyed on resource id, retrying on failure with exponential
+// backoff.
+func putTransactionBundle(target BulkPutTarget, batch []RawResource) error {
+	return retryWithBackoff(5, func() error {
+		entries := make([]map[string]interface{}, len(batch))
+		for i, res := range batch {
+			entries[i] = map[string]interface{}{
+				"resource": res,
+				"request": map[string]interface{}{
+					"method": "PUT",
+					"url":    res.ResourceType + "/" + res.ID,
+				},
+			}
+		}
+
+		bundle := map[string]interface{}{
+			"resourceType": "Bundle",
+			"type":         "transaction",
+			"entry":        entries,
+		}
+
+		body, err := json.Marshal(bundle)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, target.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Content-Type", "application/fhir+json")
+		applyBulkPutAuth(req, target)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			return errors.Errorf("target server returned %s for a batch of %d resources", resp.Status, len(batch))
+		}
+
+		return nil
+	})
+}
+
+// applyBulkPutAuth sets the Authorization header on req from target's
+// configured bearer token or basic auth credentials, preferring the
+// bearer token if both are set.
+func applyBulkPutAuth(req *http.Request, target BulkPutTarget) {
+	if target.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+target.BearerToken)
+		return
+	}
+
+	if target.BasicAuth == "" {
+		return
+	}
+
+	parts := strings.SplitN(target.BasicAuth, ":", 2)
+	if len(parts) == 2 {
+		req.SetBasicAuth(parts[0], parts[1])
+	}
+}
+
+// pushNDJSON writes resources from stream into gzipped NDJSON files, one
+// per resource type, under the destination directory or storage prefix.
+func pushNDJSON(stream *resourceStream, dest string) error {
+	writers := map[string]*ndjsonWriter{}
+
+	defer func() {
+		for _, w := range writers {
+			w.Close()
+		}
+	}()
+
+	for stream.Next() {
+		res := stream.Resource()
+
+		w, ok := writers[res.ResourceType]
+		if !ok {
+			var err error
+			w, err = newNDJSONWriter(dest, res.ResourceType)
+			if err != nil {
+				return errors.Wrapf(err, "cannot open NDJSON writer for %s", res.ResourceType)
+			}
+			writers[res.ResourceType] = w
+		}
+
+		if err := w.Write(res); err != nil {
+			return errors.Wrapf(err, "cannot write %s/%s", res.ResourceType, res.ID)
+		}
+	}
+
+	if err := stream.Err(); err != nil {
+		return errors.Wrap(err, "cannot read resource stream")
+	}
+
+	return nil
+}
+
+// ndjsonWriter gzip-compresses and appends marshaled resources to a
+// single NDJSON file opened through a storage.Backend.
+type ndjsonWriter struct {
+	w  io.WriteCloser
+	gz *gzip.Writer
+}
+
+// newNDJSONWriter opens "<resourceType>.ndjson.gz" under dest (a local
+// directory or an s3://, az:// or gs:// prefix) for writing.
+func newNDJSONWriter(dest, resourceType string) (*ndjsonWriter, error) {
+	backend, err := storage.NewBackend(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := backend.Writer(resourceType + ".ndjson.gz")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ndjsonWriter{w: w, gz: gzip.NewWriter(w)}, nil
+}
+
+func (n *ndjsonWriter) Write(res RawResource) error {
+	body, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	_, err = n.gz.Write(append(body, '\n'))
+
+	return err
+}
+
+func (n *ndjsonWriter) Close() error {
+	if err := n.gz.Close(); err != nil {
+		return err
+	}
+
+	return n.w.Close()
+}
+
+func splitCommaFlag(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	var result []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			result = append(result, part)
+		}
+	}
+
+	return result
+}
+
+// retryWithBackoff retries fn up to attempts times, sleeping 2^i seconds
+// between the i-th and (i+1)-th attempt, and returns the last error if
+// every attempt failed.
+func retryWithBackoff(attempts uint, fn func() error) error {
+	var err error
+
+	for i := uint(0); i < attempts; i++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+
+		if i < attempts-1 {
+			time.Sleep(time.Duration(1<<i) * time.Second)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommaFlag(t *testing.T) {
+	cases := map[string][]string{
+		"":                  nil,
+		"Patient":           {"Patient"},
+		"Patient,Observation": {"Patient", "Observation"},
+		" Patient , Observation ,,": {"Patient", "Observation"},
+	}
+
+	for input, expected := range cases {
+		got := splitCommaFlag(input)
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("splitCommaFlag(%q) = %v, want %v", input, got, expected)
+		}
+	}
+}
+
+func TestRetryWithBackoffReturnsNilOnEventualSuccess(t *testing.T) {
+	attempts := 0
+
+	err := retryWithBackoff(3, func() error {
+		attempts++
+		if attempts < 2 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestRetryWithBackoffReturnsLastErrorWhenExhausted(t *testing.T) {
+	boom := errors.New("boom")
+
+	err := retryWithBackoff(2, func() error {
+		return boom
+	})
+
+	if err != boom {
+		t.Errorf("expected %v, got %v", boom, err)
+	}
+}
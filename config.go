@@ -0,0 +1,47 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	// Registers the "postgres" driver used by OpenDB.
+	_ "github.com/lib/pq"
+)
+
+// PgConnConfig holds the PostgreSQL connection options accepted as
+// top-level flags (host, port, username, password, database, sslmode).
+type PgConnConfig struct {
+	Host     string
+	Port     uint
+	Username string
+	Password string
+	Database string
+	SSLMode  string
+}
+
+// PgConfig is populated from the top-level PostgreSQL connection flags
+// and is the connection every command opens against.
+var PgConfig PgConnConfig
+
+// DisableStats is set by the top-level "--nostats" flag.
+var DisableStats bool
+
+// OpenDB opens a connection to the database described by cfg.
+func OpenDB(cfg PgConnConfig) (*sql.DB, error) {
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		quoteDSNValue(cfg.Host), cfg.Port, quoteDSNValue(cfg.Username), quoteDSNValue(cfg.Password),
+		quoteDSNValue(cfg.Database), quoteDSNValue(cfg.SSLMode))
+
+	return sql.Open("postgres", dsn)
+}
+
+// quoteDSNValue wraps a libpq "keyword=value" connection-string value in
+// single quotes, escaping embedded backslashes and single quotes, so
+// that a value containing whitespace or other special characters (most
+// notably a password) can't break the keyword/value parsing or bleed
+// into the next keyword.
+func quoteDSNValue(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return `'` + escaped + `'`
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// cronSchedule is a minimal 5-field cron expression (minute hour
+// day-of-month month day-of-week), supporting "*" and comma-separated
+// lists of exact values. Step and range syntax is not supported.
+type cronSchedule struct {
+	minutes map[int]bool
+	hours   map[int]bool
+	doms    map[int]bool
+	months  map[int]bool
+	dows    map[int]bool
+}
+
+// parseCronSchedule parses a standard 5-field cron expression.
+func parseCronSchedule(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("cron expression %q must have 5 fields", expr)
+	}
+
+	minutes, err := parseCronField(fields[0], 0, 59)
+	if err != nil {
+		return nil, err
+	}
+
+	hours, err := parseCronField(fields[1], 0, 23)
+	if err != nil {
+		return nil, err
+	}
+
+	doms, err := parseCronField(fields[2], 1, 31)
+	if err != nil {
+		return nil, err
+	}
+
+	months, err := parseCronField(fields[3], 1, 12)
+	if err != nil {
+		return nil, err
+	}
+
+	dows, err := parseCronField(fields[4], 0, 6)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cronSchedule{minutes: minutes, hours: hours, doms: doms, months: months, dows: dows}, nil
+}
+
+// parseCronField expands a single cron field ("*" or a comma-separated
+// list of exact values) into the set of values it matches.
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+
+	if field == "*" {
+		for i := min; i <= max; i++ {
+			values[i] = true
+		}
+		return values, nil
+	}
+
+	for _, part := range strings.Split(field, ",") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, errors.Errorf("unsupported cron field value %q", part)
+		}
+
+		if n < min || n > max {
+			return nil, errors.Errorf("cron field value %d out of range [%d,%d]", n, min, max)
+		}
+
+		values[n] = true
+	}
+
+	return values, nil
+}
+
+// next returns the next minute-aligned time strictly after from that
+// matches the schedule, searching up to a week ahead.
+func (s *cronSchedule) next(from time.Time) (time.Time, error) {
+	t := from.Truncate(time.Minute).Add(time.Minute)
+
+	for i := 0; i < 7*24*60; i++ {
+		if s.minutes[t.Minute()] && s.hours[t.Hour()] && s.doms[t.Day()] &&
+			s.months[int(t.Month())] && s.dows[int(t.Weekday())] {
+			return t, nil
+		}
+
+		t = t.Add(time.Minute)
+	}
+
+	return time.Time{}, errors.Errorf("no time within the next week matches the schedule")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronFieldWildcard(t *testing.T) {
+	values, err := parseCronField("*", 0, 3)
+	if err != nil {
+		t.Fatalf("parseCronField returned error: %v", err)
+	}
+
+	for i := 0; i <= 3; i++ {
+		if !values[i] {
+			t.Errorf("expected %d to match wildcard field", i)
+		}
+	}
+}
+
+func TestParseCronFieldList(t *testing.T) {
+	values, err := parseCronField("1,3,5", 0, 59)
+	if err != nil {
+		t.Fatalf("parseCronField returned error: %v", err)
+	}
+
+	for _, v := range []int{1, 3, 5} {
+		if !values[v] {
+			t.Errorf("expected %d to be in the set", v)
+		}
+	}
+
+	if values[2] {
+		t.Errorf("did not expect 2 to be in the set")
+	}
+}
+
+func TestParseCronFieldOutOfRange(t *testing.T) {
+	if _, err := parseCronField("99", 0, 59); err == nil {
+		t.Error("expected an error for an out-of-range value")
+	}
+}
+
+func TestParseCronScheduleRequiresFiveFields(t *testing.T) {
+	if _, err := parseCronSchedule("* * *"); err == nil {
+		t.Error("expected an error for a cron expression with too few fields")
+	}
+}
+
+func TestCronScheduleNextFindsMatchingMinute(t *testing.T) {
+	schedule, err := parseCronSchedule("30 9 * * *")
+	if err != nil {
+		t.Fatalf("parseCronSchedule returned error: %v", err)
+	}
+
+	from := time.Date(2026, time.March, 5, 9, 0, 0, 0, time.UTC)
+
+	next, err := schedule.next(from)
+	if err != nil {
+		t.Fatalf("next returned error: %v", err)
+	}
+
+	if next.Hour() != 9 || next.Minute() != 30 || next.Day() != 5 {
+		t.Errorf("expected 2026-03-05 09:30, got %v", next)
+	}
+}
+
+func TestCronScheduleNextRollsOverToNextDay(t *testing.T) {
+	schedule, err := parseCronSchedule("0 9 * * *")
+	if err != nil {
+		t.Fatalf("parseCronSchedule returned error: %v", err)
+	}
+
+	from := time.Date(2026, time.March, 5, 10, 0, 0, 0, time.UTC)
+
+	next, err := schedule.next(from)
+	if err != nil {
+		t.Fatalf("next returned error: %v", err)
+	}
+
+	if next.Day() != 6 || next.Hour() != 9 || next.Minute() != 0 {
+		t.Errorf("expected 2026-03-06 09:00, got %v", next)
+	}
+}
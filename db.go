@@ -0,0 +1,65 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// tableName returns the table a resource type is stored in. Fhirbase
+// keeps one table per resource type, named after the lowercased type.
+func tableName(resourceType string) string {
+	return strings.ToLower(resourceType)
+}
+
+// quotedTableName returns resourceType's table name as a double-quoted
+// SQL identifier, safe to splice into a query string. resourceType
+// often comes from untrusted input (an upstream FHIR server's history
+// feed, an ingested Bundle/NDJSON file), so callers that build SQL by
+// string concatenation must go through this rather than tableName
+// directly.
+func quotedTableName(resourceType string) string {
+	return pq.QuoteIdentifier(tableName(resourceType))
+}
+
+// upsertResource inserts res into resourceType's table, updating it in
+// place if a row with the same id already exists.
+func upsertResource(db *sql.DB, resourceType, id string, res RawResource) error {
+	body, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO ` + quotedTableName(resourceType) + ` (id, resource) VALUES ($1, $2)
+ON CONFLICT (id) DO UPDATE SET resource = $2`
+
+	_, err = db.Exec(query, id, body)
+
+	return err
+}
+
+// existsResource reports whether a row with the given id is already
+// present in resourceType's table.
+func existsResource(db *sql.DB, resourceType, id string) (bool, error) {
+	var exists bool
+
+	query := `SELECT EXISTS(SELECT 1 FROM ` + quotedTableName(resourceType) + ` WHERE id = $1)`
+	err := db.QueryRow(query, id).Scan(&exists)
+
+	return exists, err
+}
+
+// deleteResource removes the row for id from resourceType's table.
+func deleteResource(db *sql.DB, resourceType, id string) error {
+	_, err := db.Exec(`DELETE FROM `+quotedTableName(resourceType)+` WHERE id = $1`, id)
+	return err
+}
+
+// markResourceDeleted marks the row for id as deleted without removing
+// it, so its history is preserved ("soft" tombstone mode).
+func markResourceDeleted(db *sql.DB, resourceType, id string) error {
+	_, err := db.Exec(`UPDATE `+quotedTableName(resourceType)+` SET deleted_at = now() WHERE id = $1`, id)
+	return err
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+// ImportManifestInput is a single `{type, url}` entry of a SMART
+// bulk-import manifest, either parsed from a FHIR Parameters resource or
+// from a plain JSON array.
+type ImportManifestInput struct {
+	Type        string `json:"type"`
+	URL         string `json:"url"`
+	InputFormat string `json:"inputFormat"`
+	InputSource string `json:"inputSource"`
+}
+
+// ImportManifestSummary reports the outcome of loading a single manifest
+// input, modeled loosely on an OperationOutcome.
+type ImportManifestSummary struct {
+	Input    ImportManifestInput
+	Inserted uint64
+	Skipped  uint64
+	Errors   []string
+}
+
+// indexedManifestInput pairs a manifest input with its position in the
+// manifest, so a worker can report its result back into the right summary
+// slot without relying on value equality (two inputs can legitimately
+// share the same {type, url}).
+type indexedManifestInput struct {
+	index int
+	input ImportManifestInput
+}
+
+// ImportManifestCommand implements the "import-manifest" subcommand: it
+// loads a SMART bulk-import manifest (a FHIR Parameters resource or a
+// plain JSON array of {type, url} entries), fetches each referenced
+// NDJSON URL and streams it directly into the copy/insert pipeline
+// without ever staging the whole file on disk.
+func ImportManifestCommand(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return cli.NewExitError("import-manifest requires a path or URL to the manifest", 1)
+	}
+
+	inputs, err := loadImportManifest(c.Args().First())
+	if err != nil {
+		return errors.Wrap(err, "cannot load import manifest")
+	}
+
+	ifNoneExist := c.Bool("if-none-exist")
+	bearerToken := c.String("source-bearer-token")
+	mode := c.String("mode")
+	numdl := c.Uint("numdl")
+
+	summaries := make([]ImportManifestSummary, len(inputs))
+
+	items := make([]interface{}, len(inputs))
+	for i, input := range inputs {
+		items[i] = indexedManifestInput{index: i, input: input}
+	}
+
+	runErr := runWithWorkers(numdl, items, func(item interface{}) error {
+		indexed := item.(indexedManifestInput)
+
+		summary, err := importManifestInput(indexed.input, mode, bearerToken, ifNoneExist)
+		summaries[indexed.index] = summary
+
+		return err
+	})
+
+	printImportManifestSummary(summaries)
+
+	if runErr != nil {
+		return errors.Wrap(runErr, "one or more manifest inputs failed")
+	}
+
+	return nil
+}
+
+// loadImportManifest fetches and parses the manifest located at src, which
+// may be a local file path or an HTTP(S) URL. Both a FHIR Parameters
+// resource (per the SMART bulk-import draft) and a plain JSON array of
+// {type, url} entries are accepted.
+func loadImportManifest(src string) ([]ImportManifestInput, error) {
+	var body []byte
+	var err error
+
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		resp, getErr := http.Get(src)
+		if getErr != nil {
+			return nil, getErr
+		}
+		defer resp.Body.Close()
+
+		body, err = ioutil.ReadAll(resp.Body)
+	} else {
+		body, err = ioutil.ReadFile(src)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var raw struct {
+		ResourceType string            `json:"resourceType"`
+		Parameter    []json.RawMessage `json:"parameter"`
+	}
+
+	if err := json.Unmarshal(body, &raw); err == nil && raw.ResourceType == "Parameters" {
+		return parseImportManifestParameters(raw.Parameter)
+	}
+
+	var inputs []ImportManifestInput
+	if err := json.Unmarshal(body, &inputs); err != nil {
+		return nil, errors.Wrap(err, "manifest is neither a Parameters resource nor a JSON array of inputs")
+	}
+
+	return inputs, nil
+}
+
+// parseImportManifestParameters extracts "input" parameters from a
+// Parameters resource, each carrying nested "type" and "url" parts, per
+// the SMART bulk-import draft.
+func parseImportManifestParameters(params []json.RawMessage) ([]ImportManifestInput, error) {
+	var inputs []ImportManifestInput
+
+	for _, raw := range params {
+		var p struct {
+			Name string `json:"name"`
+			Part []struct {
+				Name        string `json:"name"`
+				ValueString string `json:"valueString"`
+				ValueCode   string `json:"valueCode"`
+			} `json:"part"`
+		}
+
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return nil, err
+		}
+
+		if p.Name != "input" {
+			continue
+		}
+
+		var input ImportManifestInput
+		for _, part := range p.Part {
+			switch part.Name {
+			case "type":
+				input.Type = part.ValueCode
+			case "url":
+				input.URL = part.ValueString
+			case "inputFormat":
+				input.InputFormat = part.ValueCode
+			case "inputSource":
+				input.InputSource = part.ValueString
+			}
+		}
+
+		inputs = append(inputs, input)
+	}
+
+	return inputs, nil
+}
+
+// importManifestInput downloads a single manifest input and streams it
+// into the copy/insert pipeline, verifying its declared inputFormat and
+// honoring the "--if-none-exist" conditional-create behavior.
+func importManifestInput(input ImportManifestInput, mode, bearerToken string, ifNoneExist bool) (ImportManifestSummary, error) {
+	summary := ImportManifestSummary{Input: input}
+
+	if input.InputFormat != "" && input.InputFormat != "application/fhir+ndjson" {
+		return summary, errors.Errorf("unsupported inputFormat %q for %s", input.InputFormat, input.URL)
+	}
+
+	reader, err := openBearerAuthStream(input.URL, bearerToken)
+	if err != nil {
+		return summary, err
+	}
+	defer reader.Close()
+
+	return streamNDJSONIntoDB(reader, input.Type, mode, ifNoneExist, &summary)
+}
+
+// openBearerAuthStream opens url for reading, either as a local file path
+// or as an HTTP(S) GET carrying bearerToken as a Bearer Authorization
+// header, if set.
+func openBearerAuthStream(url, bearerToken string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return os.Open(url)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("server returned %s for %s", resp.Status, url)
+	}
+
+	return resp.Body, nil
+}
+
+// streamNDJSONIntoDB reads NDJSON resources off reader and loads them
+// into resourceType's table, either one INSERT/upsert at a time
+// ("insert" mode, honoring --if-none-exist) or via a single COPY FROM
+// STDIN for the whole input ("copy" mode, which does not support
+// --if-none-exist and has no conflict handling: a row whose id already
+// exists makes the COPY, and so the whole input, fail).
+func streamNDJSONIntoDB(reader io.Reader, resourceType, mode string, ifNoneExist bool, summary *ImportManifestSummary) (ImportManifestSummary, error) {
+	db, err := OpenDB(PgConfig)
+	if err != nil {
+		return *summary, errors.Wrap(err, "cannot connect to database")
+	}
+	defer db.Close()
+
+	if mode == "copy" {
+		return copyNDJSONIntoDB(db, reader, resourceType, summary)
+	}
+
+	return insertNDJSONIntoDB(db, reader, ifNoneExist, summary)
+}
+
+func insertNDJSONIntoDB(db *sql.DB, reader io.Reader, ifNoneExist bool, summary *ImportManifestSummary) (ImportManifestSummary, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var res RawResource
+		if err := res.UnmarshalJSON(line); err != nil {
+			summary.Errors = append(summary.Errors, err.Error())
+			continue
+		}
+
+		if ifNoneExist {
+			exists, err := existsResource(db, res.ResourceType, res.ID)
+			if err != nil {
+				summary.Errors = append(summary.Errors, err.Error())
+				continue
+			}
+
+			if exists {
+				summary.Skipped++
+				continue
+			}
+		}
+
+		if err := upsertResource(db, res.ResourceType, res.ID, res); err != nil {
+			summary.Errors = append(summary.Errors, err.Error())
+			continue
+		}
+
+		summary.Inserted++
+	}
+
+	return *summary, scanner.Err()
+}
+
+func copyNDJSONIntoDB(db *sql.DB, reader io.Reader, resourceType string, summary *ImportManifestSummary) (ImportManifestSummary, error) {
+	txn, err := db.Begin()
+	if err != nil {
+		return *summary, err
+	}
+
+	stmt, err := txn.Prepare(pq.CopyIn(tableName(resourceType), "id", "resource"))
+	if err != nil {
+		txn.Rollback()
+		return *summary, err
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var res RawResource
+		if err := res.UnmarshalJSON(line); err != nil {
+			summary.Errors = append(summary.Errors, err.Error())
+			continue
+		}
+
+		if _, err := stmt.Exec(res.ID, string(line)); err != nil {
+			txn.Rollback()
+			return *summary, err
+		}
+
+		summary.Inserted++
+	}
+
+	if err := scanner.Err(); err != nil {
+		txn.Rollback()
+		return *summary, err
+	}
+
+	if _, err := stmt.Exec(); err != nil {
+		txn.Rollback()
+		return *summary, err
+	}
+
+	if err := stmt.Close(); err != nil {
+		txn.Rollback()
+		return *summary, err
+	}
+
+	return *summary, txn.Commit()
+}
+
+func printImportManifestSummary(summaries []ImportManifestSummary) {
+	for _, s := range summaries {
+		fmt.Printf("%s %s: inserted=%d skipped=%d errors=%d\n",
+			s.Input.Type, s.Input.URL, s.Inserted, s.Skipped, len(s.Errors))
+
+		for _, e := range s.Errors {
+			fmt.Printf("  - %s\n", e)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseImportManifestParameters(t *testing.T) {
+	raw := []json.RawMessage{
+		json.RawMessage(`{
+			"name": "input",
+			"part": [
+				{"name": "type", "valueCode": "Patient"},
+				{"name": "url", "valueString": "https://example.com/Patient.ndjson"},
+				{"name": "inputFormat", "valueCode": "application/fhir+ndjson"}
+			]
+		}`),
+		json.RawMessage(`{"name": "inputSource", "valueString": "https://example.com"}`),
+	}
+
+	inputs, err := parseImportManifestParameters(raw)
+	if err != nil {
+		t.Fatalf("parseImportManifestParameters returned error: %v", err)
+	}
+
+	if len(inputs) != 1 {
+		t.Fatalf("expected 1 input, got %d", len(inputs))
+	}
+
+	input := inputs[0]
+	if input.Type != "Patient" || input.URL != "https://example.com/Patient.ndjson" || input.InputFormat != "application/fhir+ndjson" {
+		t.Errorf("unexpected input: %+v", input)
+	}
+}
+
+func TestImportManifestCommandSummaryIndexingAvoidsCollisions(t *testing.T) {
+	inputs := []ImportManifestInput{
+		{Type: "Patient", URL: "https://example.com/a.ndjson"},
+		{Type: "Patient", URL: "https://example.com/a.ndjson"},
+	}
+
+	summaries := make([]ImportManifestSummary, len(inputs))
+
+	items := make([]interface{}, len(inputs))
+	for i, input := range inputs {
+		items[i] = indexedManifestInput{index: i, input: input}
+	}
+
+	err := runWithWorkers(2, items, func(item interface{}) error {
+		indexed := item.(indexedManifestInput)
+		summaries[indexed.index] = ImportManifestSummary{Input: indexed.input, Inserted: uint64(indexed.index + 1)}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("runWithWorkers returned error: %v", err)
+	}
+
+	if summaries[0].Inserted != 1 || summaries[1].Inserted != 2 {
+		t.Errorf("identical {type, url} inputs clobbered each other's summary: %+v", summaries)
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"github.com/fhirbase/fhirbase/storage"
+)
+
+// LoadCommand loads FHIR resources from one or more Bulk Data URLs or file
+// paths into the Fhirbase database. Each source may be a local path or an
+// s3://, az:// or gs:// storage.Backend URI; gzip compression and the
+// actual file format (NDJSON, a transaction/collection Bundle, or a
+// single resource) are detected from content, not from the name.
+func LoadCommand(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return cli.NewExitError("load requires at least one source", 1)
+	}
+
+	mode := c.String("mode")
+	acceptHeader := c.String("accept-header")
+	numdl := c.Uint("numdl")
+	since := c.String("since")
+	scheduleExpr := c.String("schedule")
+	validateMode := c.String("validate")
+	rectify := c.Bool("rectify")
+	ifNoneExist := c.Bool("if-none-exist")
+
+	for _, src := range c.Args() {
+		if err := loadSource(src, mode, acceptHeader, numdl, since, scheduleExpr, validateMode, rectify, ifNoneExist); err != nil {
+			return errors.Wrapf(err, "cannot load %q", src)
+		}
+	}
+
+	return nil
+}
+
+// loadSource loads a single Bulk Data URL or file path. since and
+// scheduleExpr only apply to Bulk Data URLs; they're ignored for plain
+// file paths.
+func loadSource(src, mode, acceptHeader string, numdl uint, since, scheduleExpr, validateMode string, rectify, ifNoneExist bool) error {
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		return loadFromBulkDataEndpoint(src, mode, acceptHeader, numdl, since, scheduleExpr, validateMode, rectify, ifNoneExist)
+	}
+
+	return loadFromPath(src, mode, validateMode, rectify, ifNoneExist)
+}
+
+// loadFromBulkDataEndpoint pulls a Bulk Data export into a temporary
+// local directory (see "bulkget") and loads every resulting file. It
+// checkpoints the export's transactionTime in "fhirbase_bulk_state" the
+// same way "bulkget" does, so that a later run without "--since" resumes
+// from where the last run left off, and "--schedule" keeps reloading on
+// the given interval instead of exiting after the first pull.
+func loadFromBulkDataEndpoint(endpoint, mode, acceptHeader string, numdl uint, since, scheduleExpr, validateMode string, rectify, ifNoneExist bool) error {
+	db, err := OpenDB(PgConfig)
+	if err != nil {
+		return errors.Wrap(err, "cannot connect to database")
+	}
+	defer db.Close()
+
+	if err := ensureBulkStateTable(db); err != nil {
+		return err
+	}
+
+	run := func() error {
+		return loadBulkDataOnce(db, endpoint, mode, acceptHeader, numdl, since, validateMode, rectify, ifNoneExist)
+	}
+
+	if scheduleExpr == "" {
+		return run()
+	}
+
+	return runOnSchedule(scheduleExpr, run)
+}
+
+// loadBulkDataOnce resolves the effective "_since" cursor, downloads one
+// export into a temporary directory, loads every resulting file, and
+// checkpoints the new transactionTime on success.
+func loadBulkDataOnce(db *sql.DB, endpoint, mode, acceptHeader string, numdl uint, since, validateMode string, rectify, ifNoneExist bool) error {
+	effectiveSince := since
+
+	if effectiveSince == "" {
+		state, err := loadBulkState(db, endpoint)
+		if err != nil {
+			return errors.Wrap(err, "cannot load bulk state")
+		}
+
+		if !state.TransactionTime.IsZero() {
+			effectiveSince = state.TransactionTime.Format(time.RFC3339)
+		}
+	}
+
+	tmpDir, err := ioutil.TempDir("", "fhirbase-load")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifest, err := runBulkGet(endpoint, tmpDir, acceptHeader, numdl, effectiveSince)
+	if err != nil {
+		return err
+	}
+
+	files, err := ioutil.ReadDir(tmpDir)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if err := loadFromPath(filepath.Join(tmpDir, f.Name()), mode, validateMode, rectify, ifNoneExist); err != nil {
+			return err
+		}
+	}
+
+	return saveBulkState(db, endpoint, manifest.TransactionTime)
+}
+
+// loadFromPath loads a single local or object-storage source, reading it
+// one resource at a time. When validateMode isn't "off", every resource
+// is run through a ValidationPipeline before being loaded; rejected
+// resources are written to a "<path>.errors.ndjson" sidecar and, in
+// "warn" mode, skipped rather than loaded.
+func loadFromPath(path, mode, validateMode string, rectify, ifNoneExist bool) error {
+	dir, file := splitStorageRef(path)
+
+	backend, err := storage.NewBackend(dir)
+	if err != nil {
+		return err
+	}
+
+	f, err := backend.Reader(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader, err := maybeGunzip(f)
+	if err != nil {
+		return err
+	}
+
+	db, err := OpenDB(PgConfig)
+	if err != nil {
+		return errors.Wrap(err, "cannot connect to database")
+	}
+	defer db.Close()
+
+	pipeline := NewValidationPipeline(path, ValidationMode(validateMode), rectify)
+	defer pipeline.Close()
+
+	return loadResourcesFromReader(db, reader, mode, pipeline, ifNoneExist)
+}
+
+// maybeGunzip peeks at r's first two bytes and wraps it in a gzip.Reader
+// if they carry the gzip magic number, otherwise returns r unchanged.
+func maybeGunzip(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+
+	return br, nil
+}
+
+// loadResourcesFromReader decodes successive top-level JSON values off r
+// (works for both NDJSON and a single pretty-printed resource, since
+// json.Decoder.Decode ignores whitespace between values) and loads each
+// one, exploding transaction/collection Bundles into their entries.
+//
+// In "insert" mode every resource is upserted as it's read, honoring
+// ifNoneExist (skip instead of upsert if the id already exists). In
+// "copy" mode resources are buffered, grouped by type, and loaded with a
+// single COPY FROM STDIN per type once the whole source has been read;
+// ifNoneExist has no effect there, and since COPY has no conflict
+// handling, an id that already exists makes the whole load fail.
+//
+// Every resource passes through pipeline first; pipeline.Process passes
+// resources through unchanged when validation and rectification are both
+// off, so the caller doesn't need a separate code path for that case.
+func loadResourcesFromReader(db *sql.DB, r io.Reader, mode string, pipeline *ValidationPipeline, ifNoneExist bool) error {
+	dec := json.NewDecoder(r)
+	var buffered []RawResource
+
+	emit := func(res RawResource) error {
+		processed, ok, err := pipeline.Process(res)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		res = processed
+
+		if mode == "copy" {
+			buffered = append(buffered, res)
+			return nil
+		}
+
+		if ifNoneExist {
+			exists, err := existsResource(db, res.ResourceType, res.ID)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return nil
+			}
+		}
+
+		return upsertResource(db, res.ResourceType, res.ID, res)
+	}
+
+	for {
+		var res RawResource
+
+		if err := dec.Decode(&res); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if res.ResourceType == "Bundle" {
+			if err := emitBundleEntries(res, emit); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := emit(res); err != nil {
+			return err
+		}
+	}
+
+	if mode != "copy" || len(buffered) == 0 {
+		return nil
+	}
+
+	return copyResources(db, buffered)
+}
+
+// emitBundleEntries calls emit for every resource nested in a
+// transaction/collection Bundle's "entry" array.
+func emitBundleEntries(bundle RawResource, emit func(RawResource) error) error {
+	entries, _ := bundle.Raw["entry"].([]interface{})
+
+	for _, e := range entries {
+		entryMap, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		resourceRaw, ok := entryMap["resource"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		entry := RawResource{Raw: resourceRaw}
+		if rt, ok := resourceRaw["resourceType"].(string); ok {
+			entry.ResourceType = rt
+		}
+		if id, ok := resourceRaw["id"].(string); ok {
+			entry.ID = id
+		}
+
+		if err := emit(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyResources groups resources by type and loads each group with a
+// single COPY FROM STDIN, all within one transaction.
+func copyResources(db *sql.DB, resources []RawResource) error {
+	byType := map[string][]RawResource{}
+	for _, res := range resources {
+		byType[res.ResourceType] = append(byType[res.ResourceType], res)
+	}
+
+	txn, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for resourceType, group := range byType {
+		if err := copyResourceGroup(txn, resourceType, group); err != nil {
+			txn.Rollback()
+			return err
+		}
+	}
+
+	return txn.Commit()
+}
+
+func copyResourceGroup(txn *sql.Tx, resourceType string, group []RawResource) error {
+	stmt, err := txn.Prepare(pq.CopyIn(tableName(resourceType), "id", "resource"))
+	if err != nil {
+		return err
+	}
+
+	for _, res := range group {
+		body, err := json.Marshal(res)
+		if err != nil {
+			return err
+		}
+
+		if _, err := stmt.Exec(res.ID, string(body)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := stmt.Exec(); err != nil {
+		return err
+	}
+
+	return stmt.Close()
+}
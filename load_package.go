@@ -0,0 +1,277 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"github.com/fhirbase/fhirbase/storage"
+)
+
+// defaultPackageRegistry is the FHIR NPM package registry queried for
+// package refs that aren't a local tarball path.
+const defaultPackageRegistry = "https://packages.simplifier.net"
+
+// loadOrder lists conformance resource types in the order they must be
+// loaded so that references between them (e.g. a StructureDefinition's
+// ValueSet bindings) resolve.
+var loadOrder = []string{
+	"CodeSystem",
+	"ValueSet",
+	"SearchParameter",
+	"StructureDefinition",
+	"ConceptMap",
+}
+
+// FHIRPackageManifest is the relevant subset of a FHIR NPM package's
+// package.json.
+type FHIRPackageManifest struct {
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+// LoadPackageCommand implements the "load-package" subcommand: it
+// resolves one or more FHIR NPM package refs (tarball paths or
+// "name@version" registry refs), downloads them and their transitive
+// dependencies, and loads every contained conformance resource into the
+// database in dependency- and type-safe order.
+func LoadPackageCommand(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return cli.NewExitError("load-package requires at least one package tarball or ref", 1)
+	}
+
+	registry := c.String("registry")
+	if registry == "" {
+		registry = defaultPackageRegistry
+	}
+
+	resolved := map[string]bool{}
+	var resources []RawResource
+
+	for _, ref := range c.Args() {
+		pkgResources, err := resolvePackage(ref, registry, resolved)
+		if err != nil {
+			return errors.Wrapf(err, "cannot resolve package %q", ref)
+		}
+
+		resources = append(resources, pkgResources...)
+	}
+
+	ordered := orderConformanceResources(resources)
+
+	db, err := OpenDB(PgConfig)
+	if err != nil {
+		return errors.Wrap(err, "cannot connect to database")
+	}
+	defer db.Close()
+
+	var loaded int
+	for _, res := range ordered {
+		if err := upsertResource(db, res.ResourceType, res.ID, res); err != nil {
+			return errors.Wrapf(err, "cannot load %s/%s", res.ResourceType, res.ID)
+		}
+		loaded++
+	}
+
+	fmt.Printf("loaded %d conformance resources from %d package(s)\n", loaded, len(resolved))
+
+	return nil
+}
+
+// resolvePackage fetches ref (a local tarball path or a "name@version"
+// registry ref), then recursively resolves and fetches the dependencies
+// listed in its package.json, returning their resources ahead of ref's
+// own. Packages already present in seen are skipped so that a diamond
+// dependency is only fetched and loaded once.
+func resolvePackage(ref, registry string, seen map[string]bool) ([]RawResource, error) {
+	name, version := splitPackageRef(ref)
+	key := name + "@" + version
+
+	if seen[key] {
+		return nil, nil
+	}
+	seen[key] = true
+
+	body, err := fetchPackageTarball(ref, name, version, registry)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, resources, err := readPackageTarball(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var all []RawResource
+
+	for depName, depVersion := range manifest.Dependencies {
+		depResources, err := resolvePackage(depName+"@"+depVersion, registry, seen)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot resolve dependency %s@%s", depName, depVersion)
+		}
+
+		all = append(all, depResources...)
+	}
+
+	return append(all, resources...), nil
+}
+
+// splitPackageRef splits a "name@version" ref into its parts. A tarball
+// path (ending in ".tgz" or ".tar.gz") is returned whole with no version,
+// as is a ref without an "@"; the latter is still a registry name.
+func splitPackageRef(ref string) (name, version string) {
+	if strings.HasSuffix(ref, ".tgz") || strings.HasSuffix(ref, ".tar.gz") {
+		return ref, ""
+	}
+
+	idx := strings.LastIndex(ref, "@")
+	if idx <= 0 {
+		return ref, ""
+	}
+
+	return ref[:idx], ref[idx+1:]
+}
+
+// fetchPackageTarball returns the tarball bytes for ref, either by
+// reading a local path directly or by downloading
+// "<registry>/<name>/<version>".
+func fetchPackageTarball(ref, name, version, registry string) (io.ReadCloser, error) {
+	if strings.HasSuffix(ref, ".tgz") || strings.HasSuffix(ref, ".tar.gz") {
+		return openLocalOrRemote(ref)
+	}
+
+	url := fmt.Sprintf("%s/%s/%s", strings.TrimRight(registry, "/"), name, version)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("registry returned %s for %s@%s", resp.Status, name, version)
+	}
+
+	return resp.Body, nil
+}
+
+// readPackageTarball reads a gzipped tarball, returning its
+// package.json manifest and every conformance resource found in its
+// other .json entries, at any depth.
+func readPackageTarball(body io.ReadCloser) (FHIRPackageManifest, []RawResource, error) {
+	defer body.Close()
+
+	var manifest FHIRPackageManifest
+	var resources []RawResource
+
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return manifest, nil, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg || !strings.HasSuffix(header.Name, ".json") {
+			continue
+		}
+
+		if strings.HasSuffix(header.Name, "package.json") {
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return manifest, nil, err
+			}
+			continue
+		}
+
+		var res RawResource
+		if err := json.NewDecoder(tr).Decode(&res); err != nil {
+			continue
+		}
+
+		if isConformanceResourceType(res.ResourceType) {
+			resources = append(resources, res)
+		}
+	}
+
+	return manifest, resources, nil
+}
+
+// openLocalOrRemote opens ref for reading via the storage.Backend
+// abstraction, so a package tarball ref can be a local path or an
+// s3://, az:// or gs:// URI just like a "bulkget"/"load" target.
+func openLocalOrRemote(ref string) (io.ReadCloser, error) {
+	dir, file := splitStorageRef(ref)
+
+	backend, err := storage.NewBackend(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.Reader(file)
+}
+
+// splitStorageRef splits a storage.Backend URI or local path into the
+// directory/prefix half passed to storage.NewBackend and the file name
+// half passed to Backend.Reader, preserving the URI scheme (if any) on
+// the directory half so NewBackend still recognizes it.
+func splitStorageRef(ref string) (dir, file string) {
+	idx := strings.Index(ref, "://")
+	if idx < 0 {
+		return filepath.Dir(ref), filepath.Base(ref)
+	}
+
+	scheme, rest := ref[:idx+3], ref[idx+3:]
+
+	slash := strings.LastIndex(rest, "/")
+	if slash < 0 {
+		return scheme, rest
+	}
+
+	return scheme + rest[:slash], rest[slash+1:]
+}
+
+func isConformanceResourceType(resourceType string) bool {
+	for _, t := range loadOrder {
+		if t == resourceType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// orderConformanceResources sorts resources per loadOrder, so that
+// CodeSystems and ValueSets are loaded before the StructureDefinitions and
+// ConceptMaps that reference them.
+func orderConformanceResources(resources []RawResource) []RawResource {
+	byType := map[string][]RawResource{}
+
+	for _, res := range resources {
+		byType[res.ResourceType] = append(byType[res.ResourceType], res)
+	}
+
+	var ordered []RawResource
+	for _, t := range loadOrder {
+		ordered = append(ordered, byType[t]...)
+	}
+
+	return ordered
+}
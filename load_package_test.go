@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestSplitPackageRef(t *testing.T) {
+	cases := []struct {
+		ref             string
+		name, version   string
+	}{
+		{"hl7.fhir.r4.core@4.0.1", "hl7.fhir.r4.core", "4.0.1"},
+		{"hl7.fhir.r4.core", "hl7.fhir.r4.core", ""},
+		{"/tmp/hl7.fhir.r4.core-4.0.1.tgz", "/tmp/hl7.fhir.r4.core-4.0.1.tgz", ""},
+	}
+
+	for _, c := range cases {
+		name, version := splitPackageRef(c.ref)
+		if name != c.name || version != c.version {
+			t.Errorf("splitPackageRef(%q) = (%q, %q), want (%q, %q)", c.ref, name, version, c.name, c.version)
+		}
+	}
+}
+
+func TestSplitStorageRefLocalPath(t *testing.T) {
+	dir, file := splitStorageRef("/tmp/packages/hl7.fhir.r4.core-4.0.1.tgz")
+	if dir != "/tmp/packages" || file != "hl7.fhir.r4.core-4.0.1.tgz" {
+		t.Errorf("got (%q, %q)", dir, file)
+	}
+}
+
+func TestSplitStorageRefS3URI(t *testing.T) {
+	dir, file := splitStorageRef("s3://mybucket/packages/hl7.fhir.r4.core-4.0.1.tgz")
+	if dir != "s3://mybucket/packages" || file != "hl7.fhir.r4.core-4.0.1.tgz" {
+		t.Errorf("got (%q, %q)", dir, file)
+	}
+}
+
+func TestOrderConformanceResources(t *testing.T) {
+	resources := []RawResource{
+		{ResourceType: "StructureDefinition", ID: "sd1"},
+		{ResourceType: "CodeSystem", ID: "cs1"},
+		{ResourceType: "ValueSet", ID: "vs1"},
+	}
+
+	ordered := orderConformanceResources(resources)
+
+	if len(ordered) != 3 {
+		t.Fatalf("expected 3 resources, got %d", len(ordered))
+	}
+
+	if ordered[0].ResourceType != "CodeSystem" || ordered[1].ResourceType != "ValueSet" || ordered[2].ResourceType != "StructureDefinition" {
+		t.Errorf("unexpected order: %v, %v, %v", ordered[0].ResourceType, ordered[1].ResourceType, ordered[2].ResourceType)
+	}
+}
@@ -134,7 +134,7 @@ link.`,
 			UsageText: "fhirbase bulkget [--numdl=10] http://some-fhir-server.com/fhir/Patient/$everything /output/dir/",
 			Description: `
 Downloads FHIR data from Bulk Data API endpoint and saves results into
-specific directory on a local filesystem.
+specific directory.
 
 NDJSON files generated by remote server will be downloaded in
 parallel and you can specify number of threads with "--numdl" flag.
@@ -144,6 +144,24 @@ is an "--accept-header" option which sets the value for "Accept"
 header. Most likely you won't need to set it, but if Bulk Data server
 rejects queries because of "Accept" header value, consider explicitly
 set it to something it expects.
+
+TARGET DIR is not limited to a local filesystem path: an "s3://",
+"az://" or "gs://" URI may be given instead, in which case downloaded
+NDJSON files are streamed directly into the corresponding object
+storage. Credentials are taken from the usual environment variables
+(AWS_*, AZURE_STORAGE_*, GOOGLE_APPLICATION_CREDENTIALS).
+
+Pass "--since" to forward a "_since" parameter on the kickoff request
+and only pull resources that changed after that timestamp. Fhirbase
+checkpoints the exported "transactionTime" in the
+"fhirbase_bulk_state" table, keyed by endpoint URL, so a later run
+without "--since" resumes from where the last run left off; use the
+"bulk-state" command to inspect or reset that checkpoint.
+
+Pass "--schedule" (a Go duration like "1h", or a 5-field cron
+expression) to keep the process alive and re-run the export on that
+interval instead of exiting after the first pull, turning "bulkget"
+into a set-and-forget ingest agent.
 `,
 			Action: BulkGetCommand,
 			Flags: []cli.Flag{
@@ -157,6 +175,81 @@ set it to something it expects.
 					Value: "application/fhir+json",
 					Usage: "Value for Accept HTTP header (i.e. 'application/ndjson' for Cerner implementation)",
 				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "Forwarded as '_since' on the kickoff request; resumes from the checkpointed transactionTime if omitted",
+				},
+				cli.StringFlag{
+					Name:  "schedule",
+					Usage: "Keep running, re-kicking the export on this interval (Go duration or 5-field cron expression)",
+				},
+			},
+		},
+		{
+			Name:      "bulkput",
+			HelpName:  "bulkput",
+			Hidden:    false,
+			ArgsUsage: "[TARGET DIR]",
+			Usage:     "Pushes FHIR resources from the Fhirbase database to a remote FHIR server or NDJSON target",
+			UsageText: "fhirbase bulkput [--mode=bundle|ndjson] --target=http://some-fhir-server.com/fhir /output/dir/",
+			Description: `
+Reads resources out of the Fhirbase database and pushes them out,
+mirroring "bulkget" in reverse.
+
+In "bundle" mode ("--mode=bundle") resources are batched into
+transaction Bundles with PUT entries keyed on resource id and sent to
+the FHIR server specified with "--target". Batches are sent by a pool
+of parallel workers ("--numdl" controls pool size), each batch is
+retried with exponential backoff on failure.
+
+In "ndjson" mode ("--mode=ndjson", the default) resources are grouped
+by type, one gzipped NDJSON file per type as required by the Bulk Data
+grouping rule, and written to the directory given as an argument. This
+argument accepts the same local/S3/Azure Blob targets as "bulkget".
+
+Authentication against the target FHIR server can be provided with
+"--target-basic-auth user:pass" or "--target-bearer-token".
+
+Use "--resource-types" to restrict which types are pushed and
+"--since" to only push resources created or updated after a given
+timestamp.`,
+			Action: BulkPutCommand,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "mode, m",
+					Value: "ndjson",
+					Usage: "Put mode to use, possible values are 'bundle' and 'ndjson'",
+				},
+				cli.StringFlag{
+					Name:  "target",
+					Usage: "FHIR server base URL to push resources to (required in 'bundle' mode)",
+				},
+				cli.StringFlag{
+					Name:  "target-basic-auth",
+					Usage: "HTTP Basic credentials for the target server, in 'user:pass' form",
+				},
+				cli.StringFlag{
+					Name:  "target-bearer-token",
+					Usage: "Bearer token for the target server",
+				},
+				cli.UintFlag{
+					Name:  "numdl",
+					Value: 5,
+					Usage: "Number of parallel upload workers",
+				},
+				cli.UintFlag{
+					Name:  "batch-size",
+					Value: 500,
+					Usage: "Number of resources per transaction Bundle in 'bundle' mode",
+				},
+				cli.StringFlag{
+					Name:  "resource-types",
+					Usage: "Comma-separated list of resource types to push (default: all)",
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "Only push resources with meta.lastUpdated after this timestamp",
+				},
 			},
 		},
 		{
@@ -181,6 +274,12 @@ Fhirbase can read from following file types:
 Also Fhirbase can read gziped files, so all of the supported file
 formats can be additionally gziped.
 
+File paths are not limited to the local filesystem: an "s3://",
+"az://" or "gs://" URI may be given instead and Fhirbase will stream
+the object directly, without a local disk round-trip. Credentials are
+taken from the usual environment variables (AWS_*, AZURE_STORAGE_*,
+GOOGLE_APPLICATION_CREDENTIALS).
+
 You are allowed to mix different file formats and gziped/non-gziped
 files in a single command input, i.e.:
 
@@ -223,7 +322,39 @@ occurrences.
 Copy mode is intended to be used only with grouped inputs. When
 applied to grouped inputs, it's almost 3 times faster than insert
 mode. But it's same slower if it's being applied to non-grouped
-input.`,
+input.
+
+When loading from a Bulk Data URL, "--since" and "--schedule" behave
+exactly as they do for "bulkget": "--since" is forwarded as "_since"
+on the kickoff request, and Fhirbase resumes from the checkpointed
+"transactionTime" in "fhirbase_bulk_state" if it's omitted; see
+"bulk-state" to inspect or reset that checkpoint. "--schedule" keeps
+the process alive and reloads on the given interval.
+
+Pass "--validate=warn" or "--validate=strict" to run every incoming
+resource through a validation pipeline before insert/copy: a structural
+check that the resource type is in Fhirbase's built-in list of known
+types and that the id matches the FHIR id grammar, followed by a check
+that "resourceType" is present. Resources are not checked against
+StructureDefinitions, and no cardinality checks are made. In "warn" mode
+rejected resources are skipped and loading continues; in "strict"
+mode the load aborts on the first rejection. Rejected resources are
+written, one OperationOutcome per line, to a "<input>.errors.ndjson"
+sidecar file next to their source, and a summary is printed at the
+end. Default is "--validate=off".
+
+Pass "--rectify" to run a set of rectifiers before validation (also
+when validation is off), fixing common upstream bugs in place: a
+miscased top-level "status" is lowercased, decimals beyond +/-1e18 are
+clamped, and extensions without a "url" are stripped. A resource whose
+body lacks "resourceType" is not repaired. This lets Fhirbase ingest
+real-world Bulk Data exports that would otherwise fail hard on a single
+bad row.
+
+Pass "--if-none-exist" to skip resources whose id already exists in
+the database instead of upserting them, as a conditional create would.
+It only applies to "insert" mode; "copy" mode has no conflict handling,
+so an id that already exists in the database makes the load fail.`,
 			Action: LoadCommand,
 			Flags: []cli.Flag{
 				cli.StringFlag{
@@ -231,6 +362,23 @@ input.`,
 					Value: "insert",
 					Usage: "Load mode to use, possible values are 'copy' and 'insert'",
 				},
+				cli.StringFlag{
+					Name:  "validate",
+					Value: "off",
+					Usage: "Pre-load validation mode, possible values are 'off', 'warn' and 'strict'",
+				},
+				cli.BoolFlag{
+					Name:  "rectify",
+					Usage: "Fix common upstream bugs (miscased status, out-of-range decimals, extensions without a url) before validation",
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "Forwarded as '_since' on the kickoff request; resumes from the checkpointed transactionTime if omitted",
+				},
+				cli.StringFlag{
+					Name:  "schedule",
+					Usage: "Keep running, re-kicking the export and reloading it on this interval (Go duration or 5-field cron expression)",
+				},
 				cli.UintFlag{
 					Name:  "numdl",
 					Value: 5,
@@ -245,6 +393,177 @@ input.`,
 					Value: "application/fhir+json",
 					Usage: "Value for Accept HTTP header (should be application/ndjson for Cerner, application/fhir+json for Smart)",
 				},
+				cli.BoolFlag{
+					Name:  "if-none-exist",
+					Usage: "Skip resources whose id already exists instead of upserting them (conditional create)",
+				},
+			},
+		},
+		{
+			Name:      "import-manifest",
+			HelpName:  "import-manifest",
+			Hidden:    false,
+			ArgsUsage: "[MANIFEST PATH or URL]",
+			Usage:     "Loads FHIR resources described by a SMART bulk-import manifest",
+			UsageText: "fhirbase import-manifest ./manifest.json",
+			Description: `
+Loads resources per the SMART Bulk Data Import draft: the manifest is
+either a FHIR Parameters resource or a plain JSON array, each listing
+"{type, url}" entries (plus optional "inputFormat" and "inputSource").
+
+Fhirbase fetches every referenced NDJSON URL (local path or HTTP(S),
+with "--source-bearer-token" for bearer auth) and streams it directly
+into the copy/insert pipeline without staging the whole file on disk.
+Each input's declared "inputFormat" is checked and must be
+"application/fhir+ndjson"; "inputSource" is parsed from each input
+entry but is not stored or printed.
+
+Use "--if-none-exist" to skip resources whose id already exists in the
+database instead of upserting them, matching a conditional-create
+semantics. A per-input summary, loosely modeled on an OperationOutcome,
+is printed once all inputs have been processed.
+
+This lets Fhirbase act as an $import target, consuming manifests
+produced by a SMART bulk-import capable FHIR server.`,
+			Action: ImportManifestCommand,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "mode, m",
+					Value: "insert",
+					Usage: "Load mode to use, possible values are 'copy' and 'insert'",
+				},
+				cli.UintFlag{
+					Name:  "numdl",
+					Value: 5,
+					Usage: "Number of inputs to fetch and load in parallel",
+				},
+				cli.StringFlag{
+					Name:  "source-bearer-token",
+					Usage: "Bearer token used when fetching NDJSON URLs referenced by the manifest",
+				},
+				cli.BoolFlag{
+					Name:  "if-none-exist",
+					Usage: "Skip resources whose id already exists instead of upserting them (conditional create)",
+				},
+			},
+		},
+		{
+			Name:      "bulk-state",
+			HelpName:  "bulk-state",
+			Hidden:    false,
+			ArgsUsage: "[ENDPOINT]",
+			Usage:     "Inspects or resets the incremental Bulk Data checkpoint for an endpoint",
+			UsageText: "fhirbase bulk-state [--reset] http://some-fhir-server.com/fhir/Patient/$everything",
+			Description: `
+Prints the checkpointed "transactionTime" that "bulkget"/"load" will
+resume from on their next unattended run against ENDPOINT, as stored
+in the "fhirbase_bulk_state" table.
+
+Pass "--reset" to delete the checkpoint instead, forcing the next run
+to re-pull the full data set.`,
+			Action: BulkStateCommand,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "reset",
+					Usage: "Delete the checkpoint for ENDPOINT instead of printing it",
+				},
+			},
+		},
+		{
+			Name:      "sync",
+			HelpName:  "sync",
+			Hidden:    false,
+			ArgsUsage: "",
+			Usage:     "Keeps the Fhirbase database in step with an upstream FHIR REST server",
+			UsageText: "fhirbase sync --source http://some-fhir-server.com/fhir --resource-types Patient,Observation",
+			Description: `
+Reads the source FHIR REST server's history feed ("_history", per the
+History-Instance/History-Type interactions) and applies the resulting
+create/update/delete stream to the local Postgres schema.
+
+"--source" gives the server's base URL; authenticate against it with
+"--source-basic-auth user:pass" or "--source-bearer-token". Restrict
+the resource types synced with "--resource-types" (comma-separated,
+default: all) and page size with "--page-size".
+
+A per-endpoint "_since" cursor is checkpointed in the
+"fhirbase_sync_state" table after every burst of history entries
+sharing one lastUpdated instant (following the feed's "link rel=next"
+when a burst doesn't fit in one page), so an interrupted sync resumes
+from the last successfully applied burst rather than starting over.
+
+"--tombstone-mode" controls how deletes from the history feed are
+applied: "hard" (the default) removes the matching row, "soft" marks
+it deleted while keeping it around for history.
+
+Unlike "load", which performs a one-shot batch import, "sync" is meant
+to be run repeatedly (e.g. from cron) to keep an analytics database
+current with a live upstream server.`,
+			Action: SyncCommand,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "source",
+					Usage: "Source FHIR server base URL to sync from",
+				},
+				cli.StringFlag{
+					Name:  "source-basic-auth",
+					Usage: "HTTP Basic credentials for the source server, in 'user:pass' form",
+				},
+				cli.StringFlag{
+					Name:  "source-bearer-token",
+					Usage: "Bearer token for the source server",
+				},
+				cli.StringFlag{
+					Name:  "resource-types",
+					Usage: "Comma-separated list of resource types to sync (default: all)",
+				},
+				cli.UintFlag{
+					Name:  "page-size",
+					Value: 100,
+					Usage: "Number of history entries to request per page",
+				},
+				cli.StringFlag{
+					Name:  "tombstone-mode",
+					Value: "hard",
+					Usage: "How to apply deletes from the history feed, possible values are 'hard' and 'soft'",
+				},
+			},
+		},
+		{
+			Name:      "load-package",
+			HelpName:  "load-package",
+			Hidden:    false,
+			ArgsUsage: "[PACKAGE TARBALL or name@version]...",
+			Usage:     "Loads conformance resources from one or more FHIR NPM packages into the database",
+			UsageText: "fhirbase load-package hl7.fhir.us.core@6.1.0",
+			Description: `
+Loads conformance resources from FHIR NPM packages (the format used by
+the Simplifier/FHIR package registry and published implementation
+guides) into the database.
+
+Each argument is either a local package tarball path or a
+"name@version" ref, resolved against the registry given with
+"--registry" (default: the Simplifier package registry). Dependencies
+listed in a package's "package.json" are resolved and fetched
+transitively; a package already pulled in as someone else's dependency
+is only fetched once.
+
+Every contained CodeSystem, ValueSet, SearchParameter,
+StructureDefinition and ConceptMap is loaded, in that order, so that
+resources referenced by a StructureDefinition's bindings are already
+present by the time it's inserted.
+
+This lets you spin up a Fhirbase instance pre-populated with an
+implementation guide's terminology and profiles in a single command,
+rather than manually converting its artifacts to NDJSON and running
+"load" on them.`,
+			Action: LoadPackageCommand,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "registry",
+					Value: defaultPackageRegistry,
+					Usage: "FHIR NPM package registry to resolve name@version refs against",
+				},
 			},
 		},
 		{
@@ -0,0 +1,39 @@
+package main
+
+import "encoding/json"
+
+// RawResource is a FHIR resource kept in its parsed-but-untyped form: the
+// full decoded JSON body alongside its ResourceType/ID pulled out for use
+// as map/sort keys without re-parsing Raw every time.
+type RawResource struct {
+	ResourceType string
+	ID           string
+	Raw          map[string]interface{}
+}
+
+// UnmarshalJSON decodes a resource's JSON body into Raw while also
+// populating ResourceType/ID for convenient access.
+func (r *RawResource) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &r.Raw); err != nil {
+		return err
+	}
+
+	if rt, ok := r.Raw["resourceType"].(string); ok {
+		r.ResourceType = rt
+	}
+
+	if id, ok := r.Raw["id"].(string); ok {
+		r.ID = id
+	}
+
+	return nil
+}
+
+// MarshalJSON re-serializes the resource from Raw.
+func (r RawResource) MarshalJSON() ([]byte, error) {
+	if r.Raw == nil {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(r.Raw)
+}
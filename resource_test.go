@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestRawResourceUnmarshalJSONPopulatesTypeAndID(t *testing.T) {
+	var res RawResource
+
+	err := res.UnmarshalJSON([]byte(`{"resourceType":"Patient","id":"123","active":true}`))
+	if err != nil {
+		t.Fatalf("UnmarshalJSON returned error: %v", err)
+	}
+
+	if res.ResourceType != "Patient" {
+		t.Errorf("expected ResourceType 'Patient', got %q", res.ResourceType)
+	}
+
+	if res.ID != "123" {
+		t.Errorf("expected ID '123', got %q", res.ID)
+	}
+
+	if res.Raw["active"] != true {
+		t.Errorf("expected Raw[\"active\"] to be true, got %v", res.Raw["active"])
+	}
+}
+
+func TestRawResourceMarshalJSONRoundTrips(t *testing.T) {
+	var res RawResource
+
+	if err := res.UnmarshalJSON([]byte(`{"resourceType":"Patient","id":"123"}`)); err != nil {
+		t.Fatalf("UnmarshalJSON returned error: %v", err)
+	}
+
+	body, err := res.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON returned error: %v", err)
+	}
+
+	var roundTripped RawResource
+	if err := roundTripped.UnmarshalJSON(body); err != nil {
+		t.Fatalf("UnmarshalJSON of marshaled body returned error: %v", err)
+	}
+
+	if roundTripped.ResourceType != "Patient" || roundTripped.ID != "123" {
+		t.Errorf("round trip changed resource: got type=%q id=%q", roundTripped.ResourceType, roundTripped.ID)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// resourceStream reads resources out of the Fhirbase database, one
+// resource type's table at a time, each ordered by meta.lastUpdated so a
+// caller that needs to resume (bulkput's "--since") sees a stable order.
+type resourceStream struct {
+	db    *sql.DB
+	types []string
+	since string
+
+	typeIdx int
+	rows    *sql.Rows
+	current RawResource
+	err     error
+}
+
+// newResourceStream opens a resourceStream restricted to resourceTypes
+// (every known resource type, if empty) and, if since is non-empty, to
+// resources whose meta.lastUpdated is after it.
+func newResourceStream(resourceTypes []string, since string) (*resourceStream, error) {
+	db, err := OpenDB(PgConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot connect to database")
+	}
+
+	if len(resourceTypes) == 0 {
+		resourceTypes, err = listKnownResourceTypes(db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return &resourceStream{db: db, types: resourceTypes, since: since, typeIdx: -1}, nil
+}
+
+// Next advances the stream to the next resource, moving on to the next
+// resource type's table once the current one is exhausted. It returns
+// false once every type has been read or a read error occurs; callers
+// must check Err afterwards to tell the two apart.
+func (s *resourceStream) Next() bool {
+	for {
+		if s.rows == nil {
+			s.typeIdx++
+			if s.typeIdx >= len(s.types) {
+				return false
+			}
+
+			rows, err := s.queryType(s.types[s.typeIdx])
+			if err != nil {
+				s.err = err
+				return false
+			}
+
+			s.rows = rows
+		}
+
+		if s.rows.Next() {
+			var raw []byte
+			if err := s.rows.Scan(&raw); err != nil {
+				s.err = err
+				return false
+			}
+
+			if err := s.current.UnmarshalJSON(raw); err != nil {
+				continue
+			}
+
+			return true
+		}
+
+		if err := s.rows.Err(); err != nil {
+			s.err = err
+			s.rows.Close()
+			s.rows = nil
+			return false
+		}
+
+		s.rows.Close()
+		s.rows = nil
+	}
+}
+
+// Err returns the first error encountered by Next, if any. Callers must
+// check it once Next returns false to distinguish a read error from
+// genuine end-of-stream.
+func (s *resourceStream) Err() error {
+	return s.err
+}
+
+// queryType opens a cursor over resourceType's table, optionally filtered
+// by s.since.
+func (s *resourceStream) queryType(resourceType string) (*sql.Rows, error) {
+	table := quotedTableName(resourceType)
+
+	if s.since != "" {
+		query := `SELECT resource FROM ` + table + ` WHERE resource #>> '{meta,lastUpdated}' > $1 ORDER BY resource #>> '{meta,lastUpdated}'`
+		return s.db.Query(query, s.since)
+	}
+
+	query := `SELECT resource FROM ` + table + ` ORDER BY resource #>> '{meta,lastUpdated}'`
+	return s.db.Query(query)
+}
+
+// Resource returns the resource most recently read by Next.
+func (s *resourceStream) Resource() RawResource {
+	return s.current
+}
+
+// Close releases the stream's database resources.
+func (s *resourceStream) Close() error {
+	if s.rows != nil {
+		s.rows.Close()
+	}
+
+	return s.db.Close()
+}
+
+// listKnownResourceTypes returns every resource-type table present in the
+// database's public schema. It is restricted to tables that actually
+// carry a "resource" column, so Fhirbase's own metadata tables (e.g.
+// "fhirbase_bulk_state", "fhirbase_sync_state") are never mistaken for
+// resource types.
+func listKnownResourceTypes(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`
+SELECT t.table_name FROM information_schema.tables t
+WHERE t.table_schema = 'public'
+AND EXISTS (
+	SELECT 1 FROM information_schema.columns c
+	WHERE c.table_schema = t.table_schema
+	AND c.table_name = t.table_name
+	AND c.column_name = 'resource'
+)`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var types []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		types = append(types, strings.Title(name))
+	}
+
+	return types, rows.Err()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestListKnownResourceTypesFiltersOutMetadataTables(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cannot create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT t.table_name FROM information_schema.tables .* c.column_name = 'resource'").
+		WillReturnRows(sqlmock.NewRows([]string{"table_name"}).
+			AddRow("patient").
+			AddRow("observation"))
+
+	types, err := listKnownResourceTypes(db)
+	if err != nil {
+		t.Fatalf("listKnownResourceTypes returned error: %v", err)
+	}
+
+	expected := []string{"Patient", "Observation"}
+	if len(types) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, types)
+	}
+	for i, rt := range expected {
+		if types[i] != rt {
+			t.Errorf("expected %v, got %v", expected, types)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestResourceStreamNextSurfacesQueryErrors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cannot create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	boom := errors.New("boom")
+	mock.ExpectQuery(`SELECT resource FROM "patient"`).WillReturnError(boom)
+
+	stream := &resourceStream{db: db, types: []string{"Patient"}, typeIdx: -1}
+
+	if stream.Next() {
+		t.Fatal("expected Next to return false on a query error")
+	}
+
+	if stream.Err() == nil {
+		t.Error("expected Err to report the underlying query error")
+	}
+}
+
+func TestResourceStreamNextReturnsFalseAtEndOfStreamWithoutError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cannot create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT resource FROM "patient"`).
+		WillReturnRows(sqlmock.NewRows([]string{"resource"}))
+
+	stream := &resourceStream{db: db, types: []string{"Patient"}, typeIdx: -1}
+
+	if stream.Next() {
+		t.Fatal("expected Next to return false once the table is exhausted")
+	}
+
+	if stream.Err() != nil {
+		t.Errorf("expected no error at genuine end-of-stream, got %v", stream.Err())
+	}
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// azureBackend implements Backend on top of Azure Blob Storage.
+// Credentials are taken from the AZURE_STORAGE_ACCOUNT and
+// AZURE_STORAGE_ACCESS_KEY environment variables.
+type azureBackend struct {
+	container azblob.ContainerURL
+	prefix    string
+}
+
+func newAzureBackend(uri string) (*azureBackend, error) {
+	container, prefix := splitBucketPrefix(uri)
+
+	account := os.Getenv("AZURE_STORAGE_ACCOUNT")
+	accessKey := os.Getenv("AZURE_STORAGE_ACCESS_KEY")
+
+	credential, err := azblob.NewSharedKeyCredential(account, accessKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{})
+
+	u, err := url.Parse("https://" + account + ".blob.core.windows.net/" + container)
+	if err != nil {
+		return nil, err
+	}
+
+	return &azureBackend{
+		container: azblob.NewContainerURL(*u, pipeline),
+		prefix:    prefix,
+	}, nil
+}
+
+func (b *azureBackend) key(path string) string {
+	if b.prefix == "" {
+		return path
+	}
+	return b.prefix + "/" + path
+}
+
+func (b *azureBackend) Reader(path string) (io.ReadCloser, error) {
+	blob := b.container.NewBlockBlobURL(b.key(path))
+
+	resp, err := blob.Download(context.Background(), 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body(azblob.RetryReaderOptions{}), nil
+}
+
+// Writer streams directly into a block blob upload as data is written,
+// rather than buffering the whole object in memory first.
+func (b *azureBackend) Writer(path string) (io.WriteCloser, error) {
+	blob := b.container.NewBlockBlobURL(b.key(path))
+
+	return newPipeUploadWriter(func(r io.Reader) error {
+		_, err := azblob.UploadStreamToBlockBlob(context.Background(), r, blob, azblob.UploadStreamToBlockBlobOptions{})
+		return err
+	}), nil
+}
+
+func (b *azureBackend) List(prefix string) ([]string, error) {
+	var paths []string
+
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		resp, err := b.container.ListBlobsFlatSegment(context.Background(), marker, azblob.ListBlobsSegmentOptions{
+			Prefix: b.key(prefix),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range resp.Segment.BlobItems {
+			paths = append(paths, strings.TrimPrefix(item.Name, b.key("")))
+		}
+
+		marker = resp.NextMarker
+	}
+
+	return paths, nil
+}
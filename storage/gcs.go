@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// gcsBackend implements Backend on top of Google Cloud Storage.
+// Credentials are taken from GOOGLE_APPLICATION_CREDENTIALS, per the
+// standard Google client library behavior.
+type gcsBackend struct {
+	bucket *storage.BucketHandle
+	prefix string
+}
+
+func newGCSBackend(uri string) (*gcsBackend, error) {
+	bucket, prefix := splitBucketPrefix(uri)
+
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcsBackend{
+		bucket: client.Bucket(bucket),
+		prefix: prefix,
+	}, nil
+}
+
+func (b *gcsBackend) key(path string) string {
+	if b.prefix == "" {
+		return path
+	}
+	return b.prefix + "/" + path
+}
+
+func (b *gcsBackend) Reader(path string) (io.ReadCloser, error) {
+	return b.bucket.Object(b.key(path)).NewReader(context.Background())
+}
+
+func (b *gcsBackend) Writer(path string) (io.WriteCloser, error) {
+	return b.bucket.Object(b.key(path)).NewWriter(context.Background()), nil
+}
+
+func (b *gcsBackend) List(prefix string) ([]string, error) {
+	var paths []string
+
+	it := b.bucket.Objects(context.Background(), &storage.Query{Prefix: b.key(prefix)})
+
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, strings.TrimPrefix(attrs.Name, b.key("")))
+	}
+
+	return paths, nil
+}
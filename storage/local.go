@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// localBackend implements Backend on top of the local filesystem, rooted
+// at a directory.
+type localBackend struct {
+	root string
+}
+
+func newLocalBackend(root string) *localBackend {
+	return &localBackend{root: root}
+}
+
+func (b *localBackend) Reader(path string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(b.root, path))
+}
+
+func (b *localBackend) Writer(path string) (io.WriteCloser, error) {
+	full := filepath.Join(b.root, path)
+
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return nil, err
+	}
+
+	return os.Create(full)
+}
+
+func (b *localBackend) List(prefix string) ([]string, error) {
+	dir := filepath.Join(b.root, prefix)
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			paths = append(paths, filepath.Join(prefix, entry.Name()))
+		}
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,42 @@
+package storage
+
+import "io"
+
+// pipeUploadWriter turns a "give me the whole object as an io.Reader"
+// upload function (as both the S3 and Azure Blob SDKs expect) into an
+// io.WriteCloser, so object storage writes can be streamed through as
+// they're produced instead of buffered into memory first. This matters
+// for Bulk Data NDJSON exports, which can be many gigabytes per resource
+// type.
+type pipeUploadWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// newPipeUploadWriter starts upload in a goroutine, reading from the
+// returned writer's other end as it is written to. Closing the returned
+// writer waits for upload to finish and returns its error, if any.
+func newPipeUploadWriter(upload func(io.Reader) error) *pipeUploadWriter {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+
+	go func() {
+		err := upload(pr)
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	return &pipeUploadWriter{pw: pw, done: done}
+}
+
+func (w *pipeUploadWriter) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *pipeUploadWriter) Close() error {
+	if err := w.pw.Close(); err != nil {
+		return err
+	}
+
+	return <-w.done
+}
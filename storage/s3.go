@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// s3Backend implements Backend on top of Amazon S3 (and S3-compatible
+// stores such as Minio). Credentials are taken from the standard AWS_*
+// environment variables and shared config/credentials files.
+type s3Backend struct {
+	bucket   string
+	prefix   string
+	client   *s3.S3
+	uploader *s3manager.Uploader
+}
+
+func newS3Backend(uri string) (*s3Backend, error) {
+	bucket, prefix := splitBucketPrefix(uri)
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Backend{
+		bucket:   bucket,
+		prefix:   prefix,
+		client:   s3.New(sess),
+		uploader: s3manager.NewUploader(sess),
+	}, nil
+}
+
+func (b *s3Backend) key(path string) string {
+	if b.prefix == "" {
+		return path
+	}
+	return b.prefix + "/" + path
+}
+
+func (b *s3Backend) Reader(path string) (io.ReadCloser, error) {
+	out, err := b.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(path)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Body, nil
+}
+
+// Writer streams directly into a (possibly multipart) S3 upload as data is
+// written, rather than buffering the whole object in memory first.
+func (b *s3Backend) Writer(path string) (io.WriteCloser, error) {
+	return newPipeUploadWriter(func(r io.Reader) error {
+		_, err := b.uploader.Upload(&s3manager.UploadInput{
+			Bucket: aws.String(b.bucket),
+			Key:    aws.String(b.key(path)),
+			Body:   r,
+		})
+		return err
+	}), nil
+}
+
+func (b *s3Backend) List(prefix string) ([]string, error) {
+	var paths []string
+
+	err := b.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+		Prefix: aws.String(b.key(prefix)),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			paths = append(paths, strings.TrimPrefix(*obj.Key, b.key("")))
+		}
+		return true
+	})
+
+	return paths, err
+}
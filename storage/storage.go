@@ -0,0 +1,57 @@
+// Package storage provides a small abstraction over local filesystem and
+// cloud object storage, so that "bulkget" and "load" can treat a target or
+// source directory, an S3 bucket, an Azure Blob container or a GCS bucket
+// uniformly.
+package storage
+
+import (
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Backend reads and writes files identified by a path relative to the
+// backend's root (a local directory, or a bucket/container prefix).
+type Backend interface {
+	// Reader opens path for reading.
+	Reader(path string) (io.ReadCloser, error)
+
+	// Writer opens path for writing, creating or truncating it.
+	Writer(path string) (io.WriteCloser, error)
+
+	// List returns the paths under prefix, relative to the backend's
+	// root. The local backend lists only the files directly inside the
+	// prefix directory; the object-storage backends list every object
+	// whose key starts with prefix.
+	List(prefix string) ([]string, error)
+}
+
+// NewBackend resolves uri to a Backend implementation based on its scheme:
+// "s3://", "az://" and "gs://" select the respective cloud backend,
+// anything else is treated as a local filesystem path.
+func NewBackend(uri string) (Backend, error) {
+	switch {
+	case strings.HasPrefix(uri, "s3://"):
+		return newS3Backend(strings.TrimPrefix(uri, "s3://"))
+	case strings.HasPrefix(uri, "az://"):
+		return newAzureBackend(strings.TrimPrefix(uri, "az://"))
+	case strings.HasPrefix(uri, "gs://"):
+		return newGCSBackend(strings.TrimPrefix(uri, "gs://"))
+	case strings.Contains(uri, "://"):
+		return nil, errors.Errorf("unsupported storage scheme in %q", uri)
+	default:
+		return newLocalBackend(uri), nil
+	}
+}
+
+// splitBucketPrefix splits "bucket/some/prefix" into ("bucket",
+// "some/prefix"), as used by the s3://, az:// and gs:// schemes.
+func splitBucketPrefix(s string) (bucket, prefix string) {
+	parts := strings.SplitN(s, "/", 2)
+	bucket = parts[0]
+	if len(parts) > 1 {
+		prefix = parts[1]
+	}
+	return bucket, prefix
+}
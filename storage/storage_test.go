@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestSplitBucketPrefix(t *testing.T) {
+	cases := []struct {
+		input          string
+		bucket, prefix string
+	}{
+		{"mybucket", "mybucket", ""},
+		{"mybucket/some/prefix", "mybucket", "some/prefix"},
+	}
+
+	for _, c := range cases {
+		bucket, prefix := splitBucketPrefix(c.input)
+		if bucket != c.bucket || prefix != c.prefix {
+			t.Errorf("splitBucketPrefix(%q) = (%q, %q), want (%q, %q)", c.input, bucket, prefix, c.bucket, c.prefix)
+		}
+	}
+}
+
+func TestLocalBackendWriteThenRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage-local-backend")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+
+	backend := newLocalBackend(dir)
+
+	w, err := backend.Writer("sub/dir/Patient.ndjson")
+	if err != nil {
+		t.Fatalf("Writer: %v", err)
+	}
+
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	r, err := backend.Reader("sub/dir/Patient.ndjson")
+	if err != nil {
+		t.Fatalf("Reader: %v", err)
+	}
+	defer r.Close()
+
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+
+	if string(body) != "hello" {
+		t.Errorf("expected 'hello', got %q", body)
+	}
+}
+
+func TestLocalBackendList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage-local-backend-list")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+
+	backend := newLocalBackend(dir)
+
+	for _, name := range []string{"Patient.ndjson", "Observation.ndjson"} {
+		w, err := backend.Writer(name)
+		if err != nil {
+			t.Fatalf("Writer(%q): %v", name, err)
+		}
+		w.Close()
+	}
+
+	paths, err := backend.List("")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	if len(paths) != 2 {
+		t.Errorf("expected 2 paths, got %v", paths)
+	}
+}
+
+func TestNewBackendSelectsLocalForPlainPath(t *testing.T) {
+	backend, err := NewBackend("/tmp/some/dir")
+	if err != nil {
+		t.Fatalf("NewBackend: %v", err)
+	}
+
+	if _, ok := backend.(*localBackend); !ok {
+		t.Errorf("expected *localBackend, got %T", backend)
+	}
+}
+
+func TestNewBackendRejectsUnknownScheme(t *testing.T) {
+	_, err := NewBackend("ftp://example.com/dir")
+	if err == nil {
+		t.Error("expected an error for an unsupported scheme")
+	}
+}
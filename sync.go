@@ -0,0 +1,430 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+// syncStateTable is the metadata table used to checkpoint the "sync"
+// command's "_since" cursor, keyed by source endpoint URL.
+const syncStateTable = "fhirbase_sync_state"
+
+// SyncOptions holds the parsed "sync" command flags.
+type SyncOptions struct {
+	Source         string
+	BasicAuth      string
+	BearerToken    string
+	ResourceTypes  []string
+	PageSize       uint
+	TombstoneMode  string
+}
+
+// ensureSyncStateTable creates fhirbase_sync_state if it does not exist.
+func ensureSyncStateTable(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS ` + syncStateTable + ` (
+	endpoint TEXT PRIMARY KEY,
+	since TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`)
+
+	return errors.Wrap(err, "cannot create "+syncStateTable)
+}
+
+func loadSyncCursor(db *sql.DB, endpoint string) (time.Time, error) {
+	var since time.Time
+
+	row := db.QueryRow(`SELECT since FROM `+syncStateTable+` WHERE endpoint = $1`, endpoint)
+
+	err := row.Scan(&since)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+
+	return since, err
+}
+
+func saveSyncCursor(db *sql.DB, endpoint string, since time.Time) error {
+	_, err := db.Exec(`
+INSERT INTO `+syncStateTable+` (endpoint, since, updated_at)
+VALUES ($1, $2, now())
+ON CONFLICT (endpoint) DO UPDATE SET since = $2, updated_at = now()`,
+		endpoint, since)
+
+	return err
+}
+
+// SyncCommand implements the "sync" subcommand: it reads a source FHIR
+// REST endpoint's history feed (History-Instance/History-Type via
+// "_history") starting from the last checkpointed cursor and applies the
+// resulting create/update/delete stream to the local Postgres schema.
+func SyncCommand(c *cli.Context) error {
+	opts := SyncOptions{
+		Source:        c.String("source"),
+		BasicAuth:     c.String("source-basic-auth"),
+		BearerToken:   c.String("source-bearer-token"),
+		ResourceTypes: splitCommaFlag(c.String("resource-types")),
+		PageSize:      c.Uint("page-size"),
+		TombstoneMode: c.String("tombstone-mode"),
+	}
+
+	if opts.Source == "" {
+		return cli.NewExitError("sync requires --source", 1)
+	}
+
+	if opts.TombstoneMode != "hard" && opts.TombstoneMode != "soft" {
+		return cli.NewExitError(fmt.Sprintf("unknown --tombstone-mode %q, expected 'hard' or 'soft'", opts.TombstoneMode), 1)
+	}
+
+	db, err := OpenDB(PgConfig)
+	if err != nil {
+		return errors.Wrap(err, "cannot connect to database")
+	}
+	defer db.Close()
+
+	if err := ensureSyncStateTable(db); err != nil {
+		return err
+	}
+
+	since, err := loadSyncCursor(db, opts.Source)
+	if err != nil {
+		return errors.Wrap(err, "cannot load sync cursor")
+	}
+
+	return runSync(db, opts, since)
+}
+
+// runSync pages through the source endpoint's history feed starting at
+// since, applies each entry to the local schema and advances the
+// checkpoint after every burst so an interrupted sync can resume from
+// the last successfully applied burst rather than starting over.
+//
+// The "_since" cursor is treated as inclusive: a page boundary can land
+// in the middle of a run of history entries that share the exact same
+// lastUpdated instant, and an exclusive cursor would risk skipping
+// whichever of those entries sorts after the one the previous page ended
+// on. Re-applying an entry is harmless (applyHistoryEntry is an upsert or
+// an idempotent delete), so seenAtCursor tracks which entries at the
+// current cursor instant have already been applied, both to avoid
+// needless duplicate writes and to detect that a burst brought nothing
+// new, which is the signal to stop rather than re-fetch it forever. An
+// entry with no lastUpdated at all (a delete whose source omitted
+// "response.lastModified") is treated the same way, since it can never
+// advance the cursor on its own and would otherwise be re-applied
+// forever. This does mean two genuinely distinct timestamp-less entries
+// for the same resource within one burst are indistinguishable and the
+// second is dropped as a duplicate; there is no identifier in a history
+// Bundle entry to tell them apart without a lastUpdated of some kind.
+//
+// A burst is a run of pages that are still entirely at the cursor's
+// lastUpdated instant, followed via the Bundle's "link rel=next" rather
+// than re-issuing the same "_since" (which would otherwise return the
+// identical first page forever). The burst also ends the moment a page
+// brings nothing new (empty, or everything on it already in
+// seenAtCursor) so a server whose "next" link loops without making
+// progress can't hang the sync forever. As soon as a page contains an
+// entry past the cursor, the burst is over: the checkpoint is saved and
+// the next page is picked up fresh next iteration via "_since", instead of
+// paginating on through the rest of the feed in one unresumable sweep.
+func runSync(db *sql.DB, opts SyncOptions, since time.Time) error {
+	cursor := since
+	seenAtCursor := map[string]bool{}
+
+	for {
+		startCursor := cursor
+		maxLastUpdated := cursor
+		prevLastUpdated := startCursor
+		var applied int
+		var advanced bool
+
+		nextURL := ""
+		for more := true; more; {
+			var (
+				page        []HistoryEntry
+				lastUpdated time.Time
+				link        string
+				err         error
+			)
+
+			if nextURL == "" {
+				page, lastUpdated, link, err = fetchHistoryPage(opts, cursor)
+			} else {
+				page, lastUpdated, link, err = fetchHistoryPageURL(opts, nextURL, cursor)
+			}
+			if err != nil {
+				return errors.Wrap(err, "cannot fetch history page")
+			}
+
+			var pageProgress bool
+
+			for _, entry := range page {
+				if !entry.LastUpdated.IsZero() {
+					if entry.LastUpdated.Before(prevLastUpdated) {
+						return errors.Errorf("history feed returned %s/%s out of order (lastUpdated %s before %s); does %s support _sort=_lastUpdated?",
+							entry.ResourceType, entry.ID, entry.LastUpdated, prevLastUpdated, opts.Source)
+					}
+					prevLastUpdated = entry.LastUpdated
+				}
+
+				if entry.LastUpdated.Equal(startCursor) || entry.LastUpdated.IsZero() {
+					key := entry.ResourceType + "/" + entry.ID
+					if seenAtCursor[key] {
+						continue
+					}
+					seenAtCursor[key] = true
+					pageProgress = true
+				} else if entry.LastUpdated.After(startCursor) {
+					advanced = true
+					pageProgress = true
+				}
+
+				if err := applyHistoryEntry(db, entry, opts.TombstoneMode); err != nil {
+					return errors.Wrapf(err, "cannot apply %s/%s", entry.ResourceType, entry.ID)
+				}
+
+				applied++
+			}
+
+			if lastUpdated.After(maxLastUpdated) {
+				maxLastUpdated = lastUpdated
+			}
+
+			nextURL = link
+			more = nextURL != "" && !advanced && pageProgress
+		}
+
+		if maxLastUpdated.After(cursor) {
+			cursor = maxLastUpdated
+			seenAtCursor = map[string]bool{}
+		} else if applied == 0 {
+			return nil
+		}
+
+		if err := saveSyncCursor(db, opts.Source, cursor); err != nil {
+			return errors.Wrap(err, "cannot save sync cursor")
+		}
+	}
+}
+
+// historyBundle is the subset of a FHIR history Bundle this command
+// reads: one entry per history instant, with the resource body (for
+// create/update) and the request method/url that produced it, plus the
+// paging links used to read a page too large for one "_count" fetch.
+type historyBundle struct {
+	Entry []historyBundleEntry `json:"entry"`
+	Link  []struct {
+		Relation string `json:"relation"`
+		URL      string `json:"url"`
+	} `json:"link"`
+}
+
+// nextLink returns the Bundle's "link rel=next" URL, if any.
+func (b historyBundle) nextLink() string {
+	for _, link := range b.Link {
+		if link.Relation == "next" {
+			return link.URL
+		}
+	}
+
+	return ""
+}
+
+type historyBundleEntry struct {
+	Resource json.RawMessage `json:"resource"`
+	Request  struct {
+		Method string `json:"method"`
+		URL    string `json:"url"`
+	} `json:"request"`
+	Response struct {
+		LastModified string `json:"lastModified"`
+	} `json:"response"`
+}
+
+// fetchHistoryPage requests the first page of opts.Source's history
+// feed starting at (and including) since, and returns the entries found,
+// the latest lastUpdated seen on the page, and the Bundle's "link
+// rel=next" URL (if any; see fetchHistoryPageURL). Restricting to
+// opts.ResourceTypes is done with a "_type" filter, mirroring the Bulk
+// Data API's use of the same parameter. "_sort=_lastUpdated" is set
+// explicitly because runSync's burst-boundary detection depends on
+// entries arriving oldest-first, and a bare "_history" interaction is
+// not required by the spec to default to that order.
+func fetchHistoryPage(opts SyncOptions, since time.Time) ([]HistoryEntry, time.Time, string, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(opts.Source, "/")+"/_history", nil)
+	if err != nil {
+		return nil, since, "", err
+	}
+
+	q := req.URL.Query()
+	if !since.IsZero() {
+		q.Set("_since", since.UTC().Format(time.RFC3339Nano))
+	}
+	q.Set("_count", strconv.Itoa(int(opts.PageSize)))
+	q.Set("_sort", "_lastUpdated")
+	if len(opts.ResourceTypes) > 0 {
+		q.Set("_type", strings.Join(opts.ResourceTypes, ","))
+	}
+	req.URL.RawQuery = q.Encode()
+
+	applyHistoryAuth(req, opts)
+
+	return doFetchHistoryPage(req, since)
+}
+
+// fetchHistoryPageURL follows a history Bundle's "link rel=next" URL
+// directly, rather than re-issuing the original "_since"/"_count"
+// request, so a run of entries sharing one lastUpdated instant that
+// doesn't fit in a single page is read to completion instead of the
+// same first page being fetched forever.
+func fetchHistoryPageURL(opts SyncOptions, nextURL string, since time.Time) ([]HistoryEntry, time.Time, string, error) {
+	req, err := http.NewRequest(http.MethodGet, nextURL, nil)
+	if err != nil {
+		return nil, since, "", err
+	}
+
+	applyHistoryAuth(req, opts)
+
+	return doFetchHistoryPage(req, since)
+}
+
+// doFetchHistoryPage issues req and decodes its response as a history
+// Bundle, returning its entries, the latest lastUpdated among them (or
+// since if the page is empty), and its "next" link.
+func doFetchHistoryPage(req *http.Request, since time.Time) ([]HistoryEntry, time.Time, string, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, since, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, since, "", errors.Errorf("history fetch returned %s", resp.Status)
+	}
+
+	var bundle historyBundle
+	if err := json.NewDecoder(resp.Body).Decode(&bundle); err != nil {
+		return nil, since, "", err
+	}
+
+	entries := make([]HistoryEntry, 0, len(bundle.Entry))
+	lastUpdated := since
+
+	for _, e := range bundle.Entry {
+		entry, err := parseHistoryBundleEntry(e)
+		if err != nil {
+			return nil, since, "", err
+		}
+
+		entries = append(entries, entry)
+
+		if entry.LastUpdated.After(lastUpdated) {
+			lastUpdated = entry.LastUpdated
+		}
+	}
+
+	return entries, lastUpdated, bundle.nextLink(), nil
+}
+
+// parseHistoryBundleEntry turns a single history Bundle entry into a
+// HistoryEntry. The resource type and id are read off "request.url" (the
+// only place they're guaranteed to appear, since a delete entry carries
+// no resource body); lastUpdated comes from the resource's meta when one
+// is present, falling back to "response.lastModified" for delete entries,
+// which never carry a resource of their own to read meta off.
+func parseHistoryBundleEntry(e historyBundleEntry) (HistoryEntry, error) {
+	entry := HistoryEntry{Method: e.Request.Method}
+
+	parts := strings.SplitN(e.Request.URL, "/", 2)
+	if len(parts) == 2 {
+		entry.ResourceType = parts[0]
+		entry.ID = parts[1]
+	}
+
+	if len(e.Resource) > 0 {
+		if err := json.Unmarshal(e.Resource, &entry.Resource); err != nil {
+			return entry, err
+		}
+
+		if entry.ResourceType == "" {
+			entry.ResourceType = entry.Resource.ResourceType
+		}
+		if entry.ID == "" {
+			entry.ID = entry.Resource.ID
+		}
+	}
+
+	if meta, ok := entry.Resource.Raw["meta"].(map[string]interface{}); ok {
+		if lu, ok := meta["lastUpdated"].(string); ok {
+			parsed, err := time.Parse(time.RFC3339, lu)
+			if err != nil {
+				return entry, errors.Wrapf(err, "invalid meta.lastUpdated %q", lu)
+			}
+
+			entry.LastUpdated = parsed
+		}
+	}
+
+	if entry.LastUpdated.IsZero() && e.Response.LastModified != "" {
+		parsed, err := time.Parse(time.RFC3339, e.Response.LastModified)
+		if err != nil {
+			return entry, errors.Wrapf(err, "invalid response.lastModified %q", e.Response.LastModified)
+		}
+
+		entry.LastUpdated = parsed
+	}
+
+	return entry, nil
+}
+
+// applyHistoryAuth sets the Authorization header on req from opts'
+// configured bearer token or basic auth credentials, preferring the
+// bearer token if both are set.
+func applyHistoryAuth(req *http.Request, opts SyncOptions) {
+	if opts.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.BearerToken)
+		return
+	}
+
+	if opts.BasicAuth == "" {
+		return
+	}
+
+	parts := strings.SplitN(opts.BasicAuth, ":", 2)
+	if len(parts) == 2 {
+		req.SetBasicAuth(parts[0], parts[1])
+	}
+}
+
+// HistoryEntry is a single entry off a _history bundle: either a resource
+// body (create/update) or a tombstone (delete), per the FHIR history
+// interaction.
+type HistoryEntry struct {
+	ResourceType string
+	ID           string
+	Method       string
+	Resource     RawResource
+	LastUpdated  time.Time
+}
+
+// applyHistoryEntry applies a single history entry to the local schema: a
+// create/update upserts the resource row, a delete removes it in "hard"
+// tombstone mode or marks it deleted in "soft" mode (keeping its history).
+func applyHistoryEntry(db *sql.DB, entry HistoryEntry, tombstoneMode string) error {
+	if entry.Method != "DELETE" {
+		return upsertResource(db, entry.ResourceType, entry.ID, entry.Resource)
+	}
+
+	if tombstoneMode == "hard" {
+		return deleteResource(db, entry.ResourceType, entry.ID)
+	}
+
+	return markResourceDeleted(db, entry.ResourceType, entry.ID)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseHistoryBundleEntryCreate(t *testing.T) {
+	e := historyBundleEntry{
+		Resource: []byte(`{"resourceType":"Patient","id":"123","meta":{"lastUpdated":"2026-03-05T09:30:00Z"}}`),
+	}
+	e.Request.Method = "PUT"
+	e.Request.URL = "Patient/123"
+
+	entry, err := parseHistoryBundleEntry(e)
+	if err != nil {
+		t.Fatalf("parseHistoryBundleEntry returned error: %v", err)
+	}
+
+	if entry.ResourceType != "Patient" || entry.ID != "123" {
+		t.Errorf("expected Patient/123, got %s/%s", entry.ResourceType, entry.ID)
+	}
+
+	want := time.Date(2026, time.March, 5, 9, 30, 0, 0, time.UTC)
+	if !entry.LastUpdated.Equal(want) {
+		t.Errorf("expected lastUpdated %v, got %v", want, entry.LastUpdated)
+	}
+}
+
+func TestParseHistoryBundleEntryDelete(t *testing.T) {
+	e := historyBundleEntry{}
+	e.Request.Method = "DELETE"
+	e.Request.URL = "Patient/123"
+
+	entry, err := parseHistoryBundleEntry(e)
+	if err != nil {
+		t.Fatalf("parseHistoryBundleEntry returned error: %v", err)
+	}
+
+	if entry.ResourceType != "Patient" || entry.ID != "123" || entry.Method != "DELETE" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+}
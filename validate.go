@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/fhirbase/fhirbase/storage"
+)
+
+// ValidationMode controls how LoadCommand treats resources that fail
+// validation: "off" skips validation entirely, "warn" logs rejected
+// resources but loads everything else, "strict" aborts the load on the
+// first rejected resource.
+type ValidationMode string
+
+const (
+	ValidationOff    ValidationMode = "off"
+	ValidationWarn   ValidationMode = "warn"
+	ValidationStrict ValidationMode = "strict"
+)
+
+// ValidationResult is the outcome of running a resource through the
+// validation pipeline.
+type ValidationResult struct {
+	Resource RawResource
+	Rejected bool
+	Issues   []string
+}
+
+// Rectifier fixes a common class of upstream bug in-place and reports
+// whether it changed anything.
+type Rectifier func(res RawResource) (RawResource, bool)
+
+// validationStages are run, in order, against every resource passed
+// through the pipeline: a structural check (known resource type, FHIR id
+// grammar; see validateAgainstStructureDefinition), then a check that
+// resourceType is present. Neither checks the resource against a
+// StructureDefinition or its cardinalities. Rectifiers run before both,
+// when "--rectify" is given.
+var validationStages = []func(res RawResource) []string{
+	checkAgainstSchema,
+	checkRequiredFields,
+}
+
+// rectifiers are the fixers applied, in order, when "--rectify" is given.
+var rectifiers = []Rectifier{
+	rectifyMissingResourceType,
+	rectifyEnumCasing,
+	rectifyOutOfRangeDecimals,
+	rectifyUnknownExtensions,
+}
+
+// ValidationPipeline runs incoming resources through the rectifiers (if
+// rectify is true) and then the validation stages, writing rejected
+// resources as an OperationOutcome-per-line sidecar file and keeping a
+// running summary.
+type ValidationPipeline struct {
+	Mode        ValidationMode
+	Rectify     bool
+	errorsPath  string
+	errorsFile  io.WriteCloser
+	accepted    uint64
+	rejected    uint64
+	rectified   uint64
+}
+
+// NewValidationPipeline opens the "<input>.errors.ndjson" sidecar file
+// for inputPath (lazily, only once a resource is actually rejected).
+func NewValidationPipeline(inputPath string, mode ValidationMode, rectify bool) *ValidationPipeline {
+	return &ValidationPipeline{
+		Mode:       mode,
+		Rectify:    rectify,
+		errorsPath: inputPath + ".errors.ndjson",
+	}
+}
+
+// Process runs a single resource through the pipeline, returning the
+// (possibly rectified) resource and whether it should be inserted.
+func (p *ValidationPipeline) Process(res RawResource) (RawResource, bool, error) {
+	if p.Rectify {
+		for _, rectify := range rectifiers {
+			if fixed, changed := rectify(res); changed {
+				res = fixed
+				p.rectified++
+			}
+		}
+	}
+
+	if p.Mode == ValidationOff {
+		return res, true, nil
+	}
+
+	var issues []string
+	for _, stage := range validationStages {
+		issues = append(issues, stage(res)...)
+	}
+
+	if len(issues) == 0 {
+		p.accepted++
+		return res, true, nil
+	}
+
+	p.rejected++
+
+	if err := p.writeRejected(res, issues); err != nil {
+		return res, false, err
+	}
+
+	if p.Mode == ValidationStrict {
+		return res, false, fmt.Errorf("resource %s/%s failed validation: %s", res.ResourceType, res.ID, strings.Join(issues, "; "))
+	}
+
+	return res, false, nil
+}
+
+// writeRejected appends an OperationOutcome-shaped line to the sidecar
+// errors file, opening it on first use.
+func (p *ValidationPipeline) writeRejected(res RawResource, issues []string) error {
+	if p.errorsFile == nil {
+		dir, file := splitStorageRef(p.errorsPath)
+
+		backend, err := storage.NewBackend(dir)
+		if err != nil {
+			return err
+		}
+
+		f, err := backend.Writer(file)
+		if err != nil {
+			return err
+		}
+		p.errorsFile = f
+	}
+
+	outcome := map[string]interface{}{
+		"resourceType": "OperationOutcome",
+		"issue":        operationOutcomeIssues(issues),
+	}
+
+	line, err := json.Marshal(outcome)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.errorsFile.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the sidecar errors file, if one was opened, and prints the
+// end-of-run validation summary.
+func (p *ValidationPipeline) Close() error {
+	fmt.Printf("validation summary: accepted=%d rejected=%d rectified=%d\n", p.accepted, p.rejected, p.rectified)
+
+	if p.errorsFile == nil {
+		return nil
+	}
+
+	return p.errorsFile.Close()
+}
+
+func operationOutcomeIssues(messages []string) []map[string]interface{} {
+	issues := make([]map[string]interface{}, len(messages))
+
+	for i, msg := range messages {
+		issues[i] = map[string]interface{}{
+			"severity":    "error",
+			"code":        "invalid",
+			"diagnostics": msg,
+		}
+	}
+
+	return issues
+}
+
+func checkAgainstSchema(res RawResource) []string {
+	return validateAgainstStructureDefinition(res)
+}
+
+func checkRequiredFields(res RawResource) []string {
+	if res.ResourceType == "" {
+		return []string{"missing resourceType"}
+	}
+
+	return nil
+}
+
+// knownResourceTypes is the set of FHIR R4 resource type names Fhirbase
+// recognizes. This tree carries no StructureDefinition resources of its
+// own, so validateAgainstStructureDefinition checks against this set
+// rather than a real JSON-schema/StructureDefinition validator.
+var knownResourceTypes = map[string]bool{
+	"Patient": true, "Observation": true, "Condition": true, "Encounter": true,
+	"Practitioner": true, "PractitionerRole": true, "Organization": true,
+	"Procedure": true, "MedicationRequest": true, "AllergyIntolerance": true,
+	"Immunization": true, "DiagnosticReport": true, "Location": true,
+	"CodeSystem": true, "ValueSet": true, "StructureDefinition": true,
+	"SearchParameter": true, "ConceptMap": true, "Bundle": true,
+	"OperationOutcome": true,
+}
+
+// fhirIDPattern matches the grammar of the FHIR "id" datatype: up to 64
+// characters of letters, digits, "-" and ".".
+var fhirIDPattern = regexp.MustCompile(`^[A-Za-z0-9\-.]{1,64}$`)
+
+// validateAgainstStructureDefinition runs the structural checks Fhirbase
+// can make without a StructureDefinition registry: the resource type
+// must be one Fhirbase recognizes, and the id (when present) must match
+// the FHIR "id" datatype's grammar.
+func validateAgainstStructureDefinition(res RawResource) []string {
+	var issues []string
+
+	if res.ResourceType != "" && !knownResourceTypes[res.ResourceType] {
+		issues = append(issues, fmt.Sprintf("unrecognized resourceType %q", res.ResourceType))
+	}
+
+	if res.ID != "" && !fhirIDPattern.MatchString(res.ID) {
+		issues = append(issues, fmt.Sprintf("id %q does not match the FHIR id grammar", res.ID))
+	}
+
+	return issues
+}
+
+func rectifyMissingResourceType(res RawResource) (RawResource, bool) {
+	if res.ResourceType != "" {
+		return res, false
+	}
+
+	if rt, ok := res.Raw["resourceType"].(string); ok {
+		res.ResourceType = rt
+		return res, true
+	}
+
+	return res, false
+}
+
+func rectifyEnumCasing(res RawResource) (RawResource, bool) {
+	return normalizeEnumCasing(res)
+}
+
+// normalizeEnumCasing lowercases the resource's top-level "status"
+// field, the single enum upstream Bulk Data exports are seen to miscase
+// often enough (e.g. "Active" instead of "active") to be worth a
+// blanket fix.
+func normalizeEnumCasing(res RawResource) (RawResource, bool) {
+	status, ok := res.Raw["status"].(string)
+	if !ok {
+		return res, false
+	}
+
+	lower := strings.ToLower(status)
+	if lower == status {
+		return res, false
+	}
+
+	res.Raw["status"] = lower
+	return res, true
+}
+
+func rectifyOutOfRangeDecimals(res RawResource) (RawResource, bool) {
+	return clampOutOfRangeDecimals(res)
+}
+
+// maxFHIRDecimalMagnitude bounds the decimal values Fhirbase will accept
+// without rectifying; upstream exports occasionally carry values broken
+// by a unit-conversion bug that land many orders of magnitude out of
+// range.
+const maxFHIRDecimalMagnitude = 1e18
+
+// clampOutOfRangeDecimals recursively clamps any JSON number in the
+// resource whose magnitude exceeds maxFHIRDecimalMagnitude.
+func clampOutOfRangeDecimals(res RawResource) (RawResource, bool) {
+	return res, clampDecimalsIn(res.Raw)
+}
+
+func clampDecimalsIn(node interface{}) bool {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		changed := false
+
+		for k, child := range v {
+			if n, ok := child.(float64); ok {
+				switch {
+				case n > maxFHIRDecimalMagnitude:
+					v[k] = maxFHIRDecimalMagnitude
+					changed = true
+				case n < -maxFHIRDecimalMagnitude:
+					v[k] = -maxFHIRDecimalMagnitude
+					changed = true
+				}
+				continue
+			}
+
+			if clampDecimalsIn(child) {
+				changed = true
+			}
+		}
+
+		return changed
+	case []interface{}:
+		changed := false
+
+		for i, child := range v {
+			if n, ok := child.(float64); ok {
+				switch {
+				case n > maxFHIRDecimalMagnitude:
+					v[i] = maxFHIRDecimalMagnitude
+					changed = true
+				case n < -maxFHIRDecimalMagnitude:
+					v[i] = -maxFHIRDecimalMagnitude
+					changed = true
+				}
+				continue
+			}
+
+			if clampDecimalsIn(child) {
+				changed = true
+			}
+		}
+
+		return changed
+	default:
+		return false
+	}
+}
+
+func rectifyUnknownExtensions(res RawResource) (RawResource, bool) {
+	return stripUnknownExtensions(res)
+}
+
+// stripUnknownExtensions recursively removes extension entries Fhirbase
+// cannot interpret. Per the FHIR "Extension" datatype, "url" is a
+// mandatory field, so an extension object without one is malformed and
+// dropped rather than loaded as-is.
+func stripUnknownExtensions(res RawResource) (RawResource, bool) {
+	return res, stripUnknownExtensionsIn(res.Raw)
+}
+
+func stripUnknownExtensionsIn(node interface{}) bool {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		changed := false
+
+		if exts, ok := v["extension"].([]interface{}); ok {
+			kept := exts[:0:0]
+
+			for _, e := range exts {
+				if ext, ok := e.(map[string]interface{}); ok {
+					if _, hasURL := ext["url"].(string); hasURL {
+						kept = append(kept, e)
+						continue
+					}
+				}
+
+				changed = true
+			}
+
+			if changed {
+				v["extension"] = kept
+			}
+		}
+
+		for k, child := range v {
+			if k == "extension" {
+				continue
+			}
+
+			if stripUnknownExtensionsIn(child) {
+				changed = true
+			}
+		}
+
+		return changed
+	case []interface{}:
+		changed := false
+
+		for _, child := range v {
+			if stripUnknownExtensionsIn(child) {
+				changed = true
+			}
+		}
+
+		return changed
+	default:
+		return false
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import "testing"
+
+func TestValidateAgainstStructureDefinitionRejectsUnknownType(t *testing.T) {
+	issues := validateAgainstStructureDefinition(RawResource{ResourceType: "NotARealType", ID: "abc"})
+	if len(issues) != 1 {
+		t.Fatalf("expected 1 issue, got %v", issues)
+	}
+}
+
+func TestValidateAgainstStructureDefinitionRejectsBadID(t *testing.T) {
+	issues := validateAgainstStructureDefinition(RawResource{ResourceType: "Patient", ID: "has a space"})
+	if len(issues) != 1 {
+		t.Fatalf("expected 1 issue, got %v", issues)
+	}
+}
+
+func TestValidateAgainstStructureDefinitionAcceptsValidResource(t *testing.T) {
+	issues := validateAgainstStructureDefinition(RawResource{ResourceType: "Patient", ID: "abc-123"})
+	if len(issues) != 0 {
+		t.Fatalf("expected no issues, got %v", issues)
+	}
+}
+
+func TestNormalizeEnumCasingLowercasesStatus(t *testing.T) {
+	res := RawResource{Raw: map[string]interface{}{"status": "Active"}}
+
+	fixed, changed := normalizeEnumCasing(res)
+	if !changed {
+		t.Fatal("expected normalizeEnumCasing to report a change")
+	}
+	if fixed.Raw["status"] != "active" {
+		t.Errorf("expected status 'active', got %v", fixed.Raw["status"])
+	}
+}
+
+func TestNormalizeEnumCasingLeavesLowercaseAlone(t *testing.T) {
+	res := RawResource{Raw: map[string]interface{}{"status": "active"}}
+
+	_, changed := normalizeEnumCasing(res)
+	if changed {
+		t.Error("did not expect a change for an already-lowercase status")
+	}
+}
+
+func TestClampOutOfRangeDecimalsClampsNestedValue(t *testing.T) {
+	res := RawResource{Raw: map[string]interface{}{
+		"valueQuantity": map[string]interface{}{"value": 1e30},
+	}}
+
+	fixed, changed := clampOutOfRangeDecimals(res)
+	if !changed {
+		t.Fatal("expected clampOutOfRangeDecimals to report a change")
+	}
+
+	quantity := fixed.Raw["valueQuantity"].(map[string]interface{})
+	if quantity["value"] != maxFHIRDecimalMagnitude {
+		t.Errorf("expected value clamped to %v, got %v", maxFHIRDecimalMagnitude, quantity["value"])
+	}
+}
+
+func TestClampOutOfRangeDecimalsLeavesInRangeValuesAlone(t *testing.T) {
+	res := RawResource{Raw: map[string]interface{}{"valueDecimal": 98.6}}
+
+	_, changed := clampOutOfRangeDecimals(res)
+	if changed {
+		t.Error("did not expect a change for an in-range decimal")
+	}
+}
+
+func TestStripUnknownExtensionsDropsExtensionsWithoutURL(t *testing.T) {
+	res := RawResource{Raw: map[string]interface{}{
+		"extension": []interface{}{
+			map[string]interface{}{"url": "http://example.com/known", "valueString": "ok"},
+			map[string]interface{}{"valueString": "no url"},
+		},
+	}}
+
+	fixed, changed := stripUnknownExtensions(res)
+	if !changed {
+		t.Fatal("expected stripUnknownExtensions to report a change")
+	}
+
+	exts := fixed.Raw["extension"].([]interface{})
+	if len(exts) != 1 {
+		t.Fatalf("expected 1 remaining extension, got %d", len(exts))
+	}
+}
+
+func TestStripUnknownExtensionsLeavesFullyValidExtensionsAlone(t *testing.T) {
+	res := RawResource{Raw: map[string]interface{}{
+		"extension": []interface{}{
+			map[string]interface{}{"url": "http://example.com/known", "valueString": "ok"},
+		},
+	}}
+
+	_, changed := stripUnknownExtensions(res)
+	if changed {
+		t.Error("did not expect a change when every extension has a url")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "sync"
+
+// runWithWorkers runs fn once for every item in items, using up to
+// numWorkers concurrent goroutines, and returns the first error
+// encountered (if any) once every item has been processed. Distinct
+// items may be processed out of order and concurrently, but each item is
+// only ever handed to a single goroutine.
+func runWithWorkers(numWorkers uint, items []interface{}, fn func(item interface{}) error) error {
+	if numWorkers == 0 {
+		numWorkers = 1
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	sem := make(chan struct{}, numWorkers)
+
+	for _, item := range items {
+		item := item
+
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := fn(item); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return firstErr
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRunWithWorkersProcessesEveryItem(t *testing.T) {
+	items := make([]interface{}, 50)
+	for i := range items {
+		items[i] = i
+	}
+
+	var processed int32
+
+	err := runWithWorkers(4, items, func(item interface{}) error {
+		atomic.AddInt32(&processed, 1)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if int(processed) != len(items) {
+		t.Errorf("expected %d items processed, got %d", len(items), processed)
+	}
+}
+
+func TestRunWithWorkersReturnsFirstError(t *testing.T) {
+	items := []interface{}{1, 2, 3}
+	boom := errors.New("boom")
+
+	err := runWithWorkers(2, items, func(item interface{}) error {
+		if item.(int) == 2 {
+			return boom
+		}
+		return nil
+	})
+
+	if err != boom {
+		t.Errorf("expected %v, got %v", boom, err)
+	}
+}